@@ -13,4 +13,6 @@ mkdir couchbase_plugin_linux_amd64
 echo "*** Copying the release artifacts to plugin_exec_linux_amd64 folder ***"
 cp nr-couchbase-plugin-config.yml.sample couchbase_plugin_linux_amd64/
 cp nr-couchbase-plugin-definition.yml couchbase_plugin_linux_amd64/
+cp nr-couchbase-plugin-metrics.json couchbase_plugin_linux_amd64/
+cp nr-couchbase-plugin-clusters.json.sample couchbase_plugin_linux_amd64/
 cp -R ./bin couchbase_plugin_linux_amd64/bin
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/newrelic/infra-integrations-sdk/log"
+)
+
+const (
+	defaultNetwork  = "default"
+	externalNetwork = "external"
+	autoNetwork     = "auto"
+)
+
+// alternateAddress : address of a node on another network, the ports are keyed by service name
+type alternateAddress struct {
+	Hostname string
+	Ports    map[string]int
+}
+
+// alternatePortNames : names of the default service ports in the alternate addresses
+var alternatePortNames = map[int]string{
+	managementPort:    "mgmt",
+	managementSSLPort: "mgmtSSL",
+	queryPort:         "n1ql",
+	querySSLPort:      "n1qlSSL",
+	searchPort:        "fts",
+	searchSSLPort:     "ftsSSL",
+	indexPort:         "indexHttp",
+	indexSSLPort:      "indexHttps",
+}
+
+// network : network whose node addresses are used, set from the network argument or the connection string
+var network string
+
+// externalAddresses : external addresses of the nodes keyed by internal host, empty unless the external network is used
+var externalAddresses map[string]alternateAddress
+
+// addressMap : user supplied rewrites of the node addresses, keyed by internal host:port or host
+var addressMap map[string]string
+
+// parseAddressMap : comma separated internal=external pairs of host:port or host
+func parseAddressMap(value string) (map[string]string, error) {
+	rewrites := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return nil, fmt.Errorf("invalid address rewrite '%s', expected internal=external", pair)
+		}
+		rewrites[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return rewrites, nil
+}
+
+// resolveNodeAddresses : with the external network, or the auto network when the seed answering is an external address,
+// nodes are reached at the alternate addresses reported by /pools/default
+func resolveNodeAddresses(ctx context.Context) error {
+	externalAddresses = nil
+	if network == defaultNetwork {
+		return nil
+	}
+	poolData, err := httpGet(ctx, "/pools/default")
+	if err != nil {
+		return collectionFailure("/pools/default", "", "", err)
+	}
+	info, err := getDefaultPoolInfo(poolData)
+	if err != nil {
+		return collectionFailure("/pools/default", "", "", err)
+	}
+
+	addresses := map[string]alternateAddress{}
+	for _, node := range info.Nodes {
+		if external := node.AlternateAddresses.External; external.Hostname != "" {
+			addresses[addressHost(node.Hostname)] = external
+		}
+	}
+	if network == autoNetwork && !seedIsExternal(info.Nodes) {
+		return nil
+	}
+	if len(addresses) == 0 {
+		log.Warn("No node reports an external alternate address")
+	}
+	externalAddresses = addresses
+	return nil
+}
+
+// seedIsExternal : the SDK rule, the seed is external when it is not the internal address of a node but the external address of one
+func seedIsExternal(nodes []nodeInfo) bool {
+	seed := addressHost(strings.TrimPrefix(strings.TrimPrefix(baseURL, "http://"), "https://"))
+	external := false
+	for _, node := range nodes {
+		if addressHost(node.Hostname) == seed {
+			return false
+		}
+		if node.AlternateAddresses.External.Hostname == seed {
+			external = true
+		}
+	}
+	return external
+}
+
+// nodeAddress : host:port reaching port on the node reported as hostname by the cluster
+func nodeAddress(hostname string, port int) string {
+	host := addressHost(hostname)
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+	if rewritten, ok := addressMap[address]; ok {
+		return rewritten
+	}
+	if rewritten, ok := addressMap[host]; ok {
+		return net.JoinHostPort(rewritten, strconv.Itoa(port))
+	}
+	if external, ok := externalAddresses[host]; ok {
+		if alternatePort, ok := external.Ports[alternatePortNames[port]]; ok {
+			port = alternatePort
+		}
+		return net.JoinHostPort(external.Hostname, strconv.Itoa(port))
+	}
+	return address
+}
+
+func addressHost(hostname string) string {
+	host, _, err := net.SplitHostPort(hostname)
+	if err != nil {
+		return strings.Trim(hostname, "[]")
+	}
+	return host
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var alternateAddressesPoolJSON = `{
+  "clusterName": "k8s",
+  "nodes": [
+    {"hostname": "cb-0.cb.default.svc:8091", "services": ["kv", "n1ql"],
+     "alternateAddresses": {"external": {"hostname": "203.0.113.10", "ports": {"mgmt": 30091, "mgmtSSL": 30191, "n1ql": 30093}}}},
+    {"hostname": "cb-1.cb.default.svc:8091", "services": ["kv"],
+     "alternateAddresses": {"external": {"hostname": "203.0.113.11"}}},
+    {"hostname": "cb-2.cb.default.svc:8091", "services": ["kv"]}
+  ]
+}`
+
+func Test_ParseAddressMap(t *testing.T) {
+	rewrites, err := parseAddressMap("10.0.0.1:8091=cb-0.example.com:30091, 10.0.0.2 = cb-1.example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"10.0.0.1:8091": "cb-0.example.com:30091", "10.0.0.2": "cb-1.example.com"}, rewrites)
+
+	rewrites, err = parseAddressMap("")
+	assert.Nil(t, err)
+	assert.Empty(t, rewrites)
+
+	_, err = parseAddressMap("10.0.0.1:8091")
+	assert.NotNil(t, err)
+	_, err = parseAddressMap("=cb-0.example.com")
+	assert.NotNil(t, err)
+}
+
+func Test_ResolveNodeAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(alternateAddressesPoolJSON))
+	}))
+	defer server.Close()
+	defer func(n string, url string, addresses map[string]alternateAddress) {
+		network, baseURL, externalAddresses = n, url, addresses
+	}(network, baseURL, externalAddresses)
+	defer func(ssl bool) { args.SSL = ssl }(args.SSL)
+	args.SSL = false
+	baseURL = server.URL
+
+	network = defaultNetwork
+	assert.Nil(t, resolveNodeAddresses(context.Background()))
+	assert.Nil(t, externalAddresses)
+
+	network = externalNetwork
+	assert.Nil(t, resolveNodeAddresses(context.Background()))
+	assert.Len(t, externalAddresses, 2)
+	assert.Equal(t, "http://203.0.113.10:30091", nodeURL("cb-0.cb.default.svc:8091"))
+	assert.Equal(t, "http://203.0.113.10:30093", serviceURL("cb-0.cb.default.svc:8091", queryPort, querySSLPort))
+	assert.Equal(t, "http://203.0.113.11:8091", nodeURL("cb-1.cb.default.svc:8091"))
+	assert.Equal(t, "http://cb-2.cb.default.svc:8091", nodeURL("cb-2.cb.default.svc:8091"))
+	args.SSL = true
+	assert.Equal(t, "https://203.0.113.10:30191", nodeURL("cb-0.cb.default.svc:8091"))
+	args.SSL = false
+
+	// the test server is neither an internal nor an external address
+	network = autoNetwork
+	assert.Nil(t, resolveNodeAddresses(context.Background()))
+	assert.Nil(t, externalAddresses)
+}
+
+func Test_SeedIsExternal(t *testing.T) {
+	defer func(url string) { baseURL = url }(baseURL)
+	info, err := getDefaultPoolInfo([]byte(alternateAddressesPoolJSON))
+	assert.Nil(t, err)
+
+	baseURL = "https://203.0.113.10:30191"
+	assert.True(t, seedIsExternal(info.Nodes))
+	baseURL = "http://cb-1.cb.default.svc:8091"
+	assert.False(t, seedIsExternal(info.Nodes))
+	baseURL = "http://localhost:8091"
+	assert.False(t, seedIsExternal(info.Nodes))
+}
+
+func Test_NodeAddressRewrites(t *testing.T) {
+	defer func(rewrites map[string]string, addresses map[string]alternateAddress) {
+		addressMap, externalAddresses = rewrites, addresses
+	}(addressMap, externalAddresses)
+	externalAddresses = map[string]alternateAddress{"10.0.0.1": {Hostname: "203.0.113.10"}}
+	addressMap = map[string]string{"10.0.0.1:8091": "cb-0.example.com:30091", "10.0.0.2": "cb-1.example.com"}
+
+	assert.Equal(t, "cb-0.example.com:30091", nodeAddress("10.0.0.1:8091", 8091))
+	assert.Equal(t, "203.0.113.10:8093", nodeAddress("10.0.0.1:8091", 8093))
+	assert.Equal(t, "cb-1.example.com:9102", nodeAddress("10.0.0.2:8091", 9102))
+	assert.Equal(t, "10.0.0.3:8091", nodeAddress("10.0.0.3:8091", 8091))
+	assert.Equal(t, "[fd00::1]:8093", nodeAddress("[fd00::1]:8091", 8093))
+}
+
+func Test_ConnectionOption(t *testing.T) {
+	assert.Equal(t, "external", connectionOption("couchbase://h1,h2?network=external", "network"))
+	assert.Equal(t, "", connectionOption("couchbase://h1,h2", "network"))
+	assert.Equal(t, "", connectionOption("h1?network=external", "network"))
+	assert.Equal(t, "auto", connectionOption("couchbases://h1/beer?timeout=1&network=auto", "network"))
+}
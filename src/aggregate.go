@@ -0,0 +1,64 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+const defaultAggregation = "avg"
+
+// aggregations : functions reducing the samples of a stat to the reported value
+var aggregations = map[string]func(values []float64) float64{
+	"last": func(values []float64) float64 { return values[len(values)-1] },
+	"avg": func(values []float64) float64 {
+		return sumOf(values) / float64(len(values))
+	},
+	"sum": sumOf,
+	"min": func(values []float64) float64 {
+		min := values[0]
+		for _, v := range values[1:] {
+			min = math.Min(min, v)
+		}
+		return min
+	},
+	"max": func(values []float64) float64 {
+		max := values[0]
+		for _, v := range values[1:] {
+			max = math.Max(max, v)
+		}
+		return max
+	},
+	"p50": func(values []float64) float64 { return percentile(values, 50) },
+	"p95": func(values []float64) float64 { return percentile(values, 95) },
+	"p99": func(values []float64) float64 { return percentile(values, 99) },
+}
+
+// aggregate : reduces values with the named aggregation, ok is false when there is nothing to aggregate
+func aggregate(name string, values []float64) (float64, bool) {
+	if name == "" {
+		name = defaultAggregation
+	}
+	fn, known := aggregations[name]
+	if !known || len(values) == 0 {
+		return 0, false
+	}
+	return fn(values), true
+}
+
+func sumOf(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum = sum + v
+	}
+	return sum
+}
+
+// percentile : linear interpolation between the closest ranks
+func percentile(values []float64, p float64) float64 {
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Aggregate(t *testing.T) {
+	values := []float64{4, 1, 3, 2, 10}
+	var tests = []struct {
+		name     string
+		expected float64
+	}{
+		{"", 4},
+		{"avg", 4},
+		{"last", 10},
+		{"sum", 20},
+		{"min", 1},
+		{"max", 10},
+		{"p50", 3},
+		{"p95", 8.8},
+		{"p99", 9.76},
+	}
+	for _, tt := range tests {
+		v, ok := aggregate(tt.name, values)
+
+		assert.True(t, ok, tt.name)
+		assert.InDelta(t, tt.expected, v, 0.000001, tt.name)
+	}
+	assert.Equal(t, []float64{4, 1, 3, 2, 10}, values)
+}
+
+func Test_AggregateNothing(t *testing.T) {
+	_, ok := aggregate("avg", []float64{})
+	assert.False(t, ok)
+
+	_, ok = aggregate("median", []float64{1})
+	assert.False(t, ok)
+}
+
+func Test_PercentileSingleValue(t *testing.T) {
+	assert.Equal(t, float64(7), percentile([]float64{7}, 99))
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/newrelic/infra-integrations-sdk/log"
+	"github.com/newrelic/infra-integrations-sdk/sdk"
+)
+
+// catalogueMetric : a bucket stat definition of the metric catalogue file
+type catalogueMetric struct {
+	Name        string          `json:"name"`
+	Path        string          `json:"path"`
+	Type        string          `json:"type"`
+	Rename      string          `json:"rename"`
+	Unit        string          `json:"unit"`
+	Aggregation string          `json:"aggregation"`
+	Range       *catalogueRange `json:"range"`
+}
+
+// catalogueRange : the Couchbase 7 stats range metric, labels and functions a bucket stat is read from
+type catalogueRange struct {
+	Name      string            `json:"name"`
+	Labels    map[string]string `json:"labels"`
+	Functions []string          `json:"functions"`
+}
+
+// catalogueDerived : a derived metric definition of the metric catalogue file
+type catalogueDerived struct {
+	Name       string `json:"name"`
+	Expression string `json:"expression"`
+}
+
+type metricCatalogue struct {
+	Metrics []catalogueMetric   `json:"metrics"`
+	Derived *[]catalogueDerived `json:"derived"`
+}
+
+var metricTypeNames = map[string]metricType{
+	"gauge":     gauge,
+	"delta":     delta,
+	"rate":      rate,
+	"attribute": attribute,
+}
+
+var metricUnits = map[string]bool{
+	"":             true,
+	"bytes":        true,
+	"count":        true,
+	"ops/s":        true,
+	"percent":      true,
+	"seconds":      true,
+	"milliseconds": true,
+	"microseconds": true,
+}
+
+// cataloguePath : a relative path missing from the working directory is looked up in the integration
+// directory, the parent of the bin directory holding the executable
+func cataloguePath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return path
+	}
+	installed := filepath.Join(filepath.Dir(filepath.Dir(executable)), path)
+	if _, err := os.Stat(installed); err == nil {
+		return installed
+	}
+	return path
+}
+
+// loadMetricCatalogue : reads the bucket stats and derived metric definitions from a JSON metric catalogue,
+// without a derived list the built-in derived metrics whose inputs are collected are kept
+func loadMetricCatalogue(path string) (map[string]metricDef, []derivedMetric, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var catalogue metricCatalogue
+	if err := json.Unmarshal(data, &catalogue); err != nil {
+		return nil, nil, fmt.Errorf("invalid metric catalogue: %v", err)
+	}
+	metrics, err := parseCatalogueMetrics(catalogue.Metrics)
+	if err != nil {
+		return nil, nil, err
+	}
+	if catalogue.Derived == nil {
+		derived := []derivedMetric{}
+		for _, d := range defaultDerivedMetrics {
+			if err := checkDerivedInputs(metrics, append(derived, d)); err != nil {
+				log.Debug("Skipping built-in derived metric: %v", err)
+				continue
+			}
+			derived = append(derived, d)
+		}
+		return metrics, derived, nil
+	}
+	derived, err := parseCatalogueDerived(*catalogue.Derived)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkDerivedInputs(metrics, derived); err != nil {
+		return nil, nil, err
+	}
+	return metrics, derived, nil
+}
+
+func parseCatalogueMetrics(entries []catalogueMetric) (map[string]metricDef, error) {
+
+	metrics := map[string]metricDef{}
+	for i, m := range entries {
+		name := strings.TrimSpace(m.Name)
+		if name == "" {
+			return nil, fmt.Errorf("metric catalogue entry %d has no name", i)
+		}
+		if _, ok := metrics[name]; ok {
+			return nil, fmt.Errorf("metric '%s' is defined twice in the metric catalogue", name)
+		}
+		typeName := strings.TrimSpace(m.Type)
+		if typeName == "" {
+			typeName = "gauge"
+		}
+		t, ok := metricTypeNames[typeName]
+		if !ok {
+			return nil, fmt.Errorf("metric '%s' has unknown type '%s'", name, m.Type)
+		}
+		if !metricUnits[m.Unit] {
+			return nil, fmt.Errorf("metric '%s' has unknown unit '%s'", name, m.Unit)
+		}
+		aggregation := strings.TrimSpace(m.Aggregation)
+		if _, ok := aggregations[aggregation]; aggregation != "" && !ok {
+			return nil, fmt.Errorf("metric '%s' has unknown aggregation '%s'", name, m.Aggregation)
+		}
+		def := metricDef{
+			metricT:     t,
+			metricN:     strings.TrimSpace(m.Rename),
+			path:        strings.TrimSpace(m.Path),
+			unit:        m.Unit,
+			aggregation: aggregation,
+		}
+		if m.Range != nil {
+			if strings.TrimSpace(m.Range.Name) == "" {
+				return nil, fmt.Errorf("metric '%s' has a range without a name", name)
+			}
+			def.rangeStat = &rangeStat{strings.TrimSpace(m.Range.Name), m.Range.Labels, m.Range.Functions}
+		}
+		metrics[name] = def
+	}
+	return metrics, nil
+}
+
+func parseCatalogueDerived(entries []catalogueDerived) ([]derivedMetric, error) {
+	derived := []derivedMetric{}
+	for i, d := range entries {
+		name := strings.TrimSpace(d.Name)
+		if name == "" {
+			return nil, fmt.Errorf("derived metric entry %d has no name", i)
+		}
+		m, err := newDerivedMetric(name, d.Expression)
+		if err != nil {
+			return nil, err
+		}
+		derived = append(derived, m)
+	}
+	return derived, nil
+}
+
+// checkDerivedInputs : derived metrics may only use reported metrics and the derived metrics defined before them
+func checkDerivedInputs(metrics map[string]metricDef, derived []derivedMetric) error {
+	known := map[string]bool{}
+	for name, def := range metrics {
+		known[def.reportedName(name)] = true
+	}
+	for _, d := range derived {
+		for _, v := range d.compiled.variables() {
+			if !known[v] {
+				return fmt.Errorf("derived metric '%s' uses unknown metric '%s'", d.name, v)
+			}
+		}
+		known[d.name] = true
+	}
+	return nil
+}
+
+// statsPath : picker path of the stat samples, defaults to the stat name under op/samples
+func (d metricDef) statsPath(name string) string {
+	if d.path != "" {
+		return d.path
+	}
+	return "op/samples/" + name
+}
+
+// reportedName : name the metric is reported under, metricN renames the Couchbase stat
+func (d metricDef) reportedName(name string) string {
+	if d.metricN != "" {
+		return d.metricN
+	}
+	return name
+}
+
+// setMetricInventory : the type, unit and aggregation of every reported bucket stat
+func setMetricInventory(inventory sdk.Inventory, metrics map[string]metricDef) {
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		def := metrics[name]
+		key := "metric/" + def.reportedName(name)
+		inventory.SetItem(key, "type", metricTypeName(def.metricT))
+		if def.unit != "" {
+			inventory.SetItem(key, "unit", def.unit)
+		}
+		aggregation := def.aggregation
+		if aggregation == "" {
+			aggregation = defaultAggregation
+		}
+		inventory.SetItem(key, "aggregation", aggregation)
+	}
+}
+
+func metricTypeName(t metricType) string {
+	for name, value := range metricTypeNames {
+		if value == t {
+			return name
+		}
+	}
+	return ""
+}
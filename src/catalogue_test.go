@@ -0,0 +1,127 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/newrelic/infra-integrations-sdk/sdk"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMain : the tests collect the bucket stats of the shipped metric catalogue
+func TestMain(m *testing.M) {
+	var err error
+	configuredMetrics, configuredDerivedMetrics, err = loadMetricCatalogue("../nr-couchbase-plugin-metrics.json")
+	if err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func Test_ShippedMetricCatalogue(t *testing.T) {
+	metrics, derived, err := loadMetricCatalogue("../nr-couchbase-plugin-metrics.json")
+
+	assert.Nil(t, err)
+	assert.Equal(t, len(defaultDerivedMetrics), len(derived))
+	for i, d := range defaultDerivedMetrics {
+		assert.Equal(t, d.name, derived[i].name)
+		assert.Equal(t, d.expression, derived[i].expression)
+	}
+	assert.Len(t, metrics, 27)
+	for name, def := range metrics {
+		assert.NotNil(t, def.rangeStat, name)
+		assert.NotEmpty(t, def.unit, name)
+	}
+	assert.Equal(t, &rangeStat{"kv_ops", map[string]string{"op": "delete", "result": "miss"}, []string{"irate"}}, metrics["delete_misses"].rangeStat)
+}
+
+func Test_ParseMetricCatalogue(t *testing.T) {
+	path := writeCatalogue(t, `{
+		"metrics": [
+			{"name": "ep_bg_fetched", "type": "rate", "unit": "ops/s", "aggregation": "last", "range": {"name": "kv_ep_bg_fetched", "functions": ["irate"]}},
+			{"name": "couch_docs_actual_disk_size", "path": "op/samples/couch_docs_actual_disk_size", "rename": "disk_size", "unit": "bytes"}
+		],
+		"derived": [
+			{"name": "disk_size_mb", "expression": "disk_size / (1024 * 1024)"}
+		]
+	}`)
+	defer os.Remove(path)
+
+	metrics, derived, err := loadMetricCatalogue(path)
+
+	assert.Nil(t, err)
+	assert.Len(t, derived, 1)
+	assert.Equal(t, "disk_size_mb", derived[0].name)
+	assert.Len(t, metrics, 2)
+	assert.Equal(t, rate, metrics["ep_bg_fetched"].metricT)
+	assert.Equal(t, "last", metrics["ep_bg_fetched"].aggregation)
+	assert.Equal(t, "op/samples/ep_bg_fetched", metrics["ep_bg_fetched"].statsPath("ep_bg_fetched"))
+	assert.Equal(t, "ep_bg_fetched", metrics["ep_bg_fetched"].reportedName("ep_bg_fetched"))
+	assert.Equal(t, &rangeStat{"kv_ep_bg_fetched", nil, []string{"irate"}}, metrics["ep_bg_fetched"].rangeStat)
+	assert.Nil(t, metrics["couch_docs_actual_disk_size"].rangeStat)
+	assert.Equal(t, gauge, metrics["couch_docs_actual_disk_size"].metricT)
+	assert.Equal(t, "disk_size", metrics["couch_docs_actual_disk_size"].reportedName("couch_docs_actual_disk_size"))
+}
+
+func Test_ParseMetricCatalogueErrors(t *testing.T) {
+	var tests = []string{
+		`{"metrics": [{"name": ""}]}`,
+		`{"metrics": [{"name": "cmd_get", "type": "counter"}]}`,
+		`{"metrics": [{"name": "cmd_get", "unit": "furlongs"}]}`,
+		`{"metrics": [{"name": "cmd_get"}, {"name": "cmd_get"}]}`,
+		`{"metrics": `,
+		`{"metrics": [{"name": "cmd_get", "aggregation": "median"}]}`,
+		`{"metrics": [{"name": "cmd_get", "range": {"labels": {"op": "get"}}}]}`,
+		`{"metrics": [{"name": "cmd_get"}], "derived": [{"name": "twice", "expression": "2 * cmd_set"}]}`,
+		`{"metrics": [{"name": "cmd_get"}], "derived": [{"name": "broken", "expression": "cmd_get +"}]}`,
+	}
+	for _, catalogue := range tests {
+		path := writeCatalogue(t, catalogue)
+		_, _, err := loadMetricCatalogue(path)
+		os.Remove(path)
+
+		assert.NotNil(t, err, catalogue)
+	}
+}
+
+func Test_LoadMetricCatalogueKeepsUsableBuiltInDerived(t *testing.T) {
+	path := writeCatalogue(t, `{"metrics": [{"name": "ep_queue_size"}, {"name": "ep_flusher_todo"}]}`)
+	defer os.Remove(path)
+
+	_, derived, err := loadMetricCatalogue(path)
+
+	assert.Nil(t, err)
+	assert.Len(t, derived, 1)
+	assert.Equal(t, "disk_write_queue", derived[0].name)
+}
+
+func Test_CataloguePath(t *testing.T) {
+	assert.Equal(t, "/etc/couchbase-metrics.json", cataloguePath("/etc/couchbase-metrics.json"))
+	assert.Equal(t, "../nr-couchbase-plugin-metrics.json", cataloguePath("../nr-couchbase-plugin-metrics.json"))
+	assert.Equal(t, "missing-metrics.json", cataloguePath("missing-metrics.json"))
+}
+
+func Test_SetMetricInventory(t *testing.T) {
+	inventory := sdk.Inventory{}
+	setMetricInventory(inventory, map[string]metricDef{
+		"cmd_get":                     metricDef{metricT: gauge, unit: "ops/s"},
+		"couch_docs_actual_disk_size": metricDef{metricT: delta, metricN: "disk_size", aggregation: "last"},
+	})
+
+	assert.Equal(t, "gauge", inventory["metric/cmd_get"]["type"])
+	assert.Equal(t, "ops/s", inventory["metric/cmd_get"]["unit"])
+	assert.Equal(t, "avg", inventory["metric/cmd_get"]["aggregation"])
+	assert.Equal(t, "delta", inventory["metric/disk_size"]["type"])
+	assert.Equal(t, "last", inventory["metric/disk_size"]["aggregation"])
+	assert.NotContains(t, inventory["metric/disk_size"], "unit")
+}
+
+func writeCatalogue(t *testing.T, catalogue string) string {
+	f, err := ioutil.TempFile("", "couchbase-plugin-metrics")
+	assert.Nil(t, err)
+	defer f.Close()
+	_, err = f.WriteString(catalogue)
+	assert.Nil(t, err)
+	return f.Name()
+}
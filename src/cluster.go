@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"strconv"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/log"
+	"github.com/newrelic/infra-integrations-sdk/metric"
+	"github.com/newrelic/infra-integrations-sdk/sdk"
+)
+
+// pickedMetric : a metric read from a single picker property
+type pickedMetric struct {
+	path    string
+	pickT   string
+	metricT metricType
+}
+
+var clusterMetrics = map[string]pickedMetric{
+	"ram.total":                  pickedMetric{"storageTotals/ram/total", "f", gauge},
+	"ram.used":                   pickedMetric{"storageTotals/ram/used", "f", gauge},
+	"ram.usedByData":             pickedMetric{"storageTotals/ram/usedByData", "f", gauge},
+	"ram.quotaTotal":             pickedMetric{"storageTotals/ram/quotaTotal", "f", gauge},
+	"ram.quotaUsed":              pickedMetric{"storageTotals/ram/quotaUsed", "f", gauge},
+	"ram.quotaTotalPerNode":      pickedMetric{"storageTotals/ram/quotaTotalPerNode", "f", gauge},
+	"ram.quotaUsedPerNode":       pickedMetric{"storageTotals/ram/quotaUsedPerNode", "f", gauge},
+	"hdd.total":                  pickedMetric{"storageTotals/hdd/total", "f", gauge},
+	"hdd.used":                   pickedMetric{"storageTotals/hdd/used", "f", gauge},
+	"hdd.usedByData":             pickedMetric{"storageTotals/hdd/usedByData", "f", gauge},
+	"hdd.quotaTotal":             pickedMetric{"storageTotals/hdd/quotaTotal", "f", gauge},
+	"hdd.free":                   pickedMetric{"storageTotals/hdd/free", "f", gauge},
+	"memoryQuota":                pickedMetric{"memoryQuota", "f", gauge},
+	"indexMemoryQuota":           pickedMetric{"indexMemoryQuota", "f", gauge},
+	"ftsMemoryQuota":             pickedMetric{"ftsMemoryQuota", "f", gauge},
+	"cbasMemoryQuota":            pickedMetric{"cbasMemoryQuota", "f", gauge},
+	"eventingMemoryQuota":        pickedMetric{"eventingMemoryQuota", "f", gauge},
+	"rebalanceStatus":            pickedMetric{"rebalanceStatus", "s", attribute},
+	"balanced":                   pickedMetric{"balanced", "b", gauge},
+	"clusterName":                pickedMetric{"clusterName", "s", attribute},
+	"maxBucketCount":             pickedMetric{"maxBucketCount", "f", gauge},
+	"counters.rebalance_start":   pickedMetric{"counters/rebalance_start", "f", gauge},
+	"counters.rebalance_success": pickedMetric{"counters/rebalance_success", "f", gauge},
+	"counters.rebalance_fail":    pickedMetric{"counters/rebalance_fail", "f", gauge},
+	"counters.failover_node":     pickedMetric{"counters/failover_node", "f", gauge},
+}
+
+var nodeStatuses = []string{"healthy", "warmup", "unhealthy"}
+
+func populateClusterStats(integration *sdk.Integration, poolData []byte) error {
+	ms := newMetricSet(integration, "CouchbaseClusterSample")
+	setPickedMetrics(ms, poolData, clusterMetrics)
+
+	var statuses []string
+	config := Config{
+		Properties: []Property{
+			{Path: "nodes/status", Type: "[]o"},
+		},
+	}
+	err := PickDeserializedUsingConfig(bytes.NewReader(poolData), config, "status", &statuses)
+	if err != nil {
+		return err
+	}
+	counts := map[string]int{}
+	for _, status := range statuses {
+		counts[status]++
+	}
+	ms.SetMetric("nodes.total", len(statuses), metric.GAUGE)
+	for _, status := range nodeStatuses {
+		ms.SetMetric("nodes."+status, counts[status], metric.GAUGE)
+	}
+	return nil
+}
+
+// setPickedMetrics : sets every metric present in data, metrics missing from the response are skipped
+func setPickedMetrics(ms *metric.MetricSet, data []byte, metrics map[string]pickedMetric) {
+	for metricName, def := range metrics {
+		alias := metricName
+		config := Config{
+			Properties: []Property{
+				{Path: def.path, Type: def.pickT, Alias: &alias},
+			},
+		}
+		res, err := PickUsingConfig(bytes.NewReader(data), config)
+		if err != nil {
+			log.Debug("Skipping metric %s: %v", metricName, err)
+			continue
+		}
+		value := (*res)[alias]
+		if b, ok := value.(bool); ok {
+			value = 0
+			if b {
+				value = 1
+			}
+		}
+		if s, ok := value.(string); ok && def.metricT != attribute {
+			v, err := parseNumeric(s)
+			if err != nil {
+				log.Debug("Skipping metric %s: %v", metricName, err)
+				continue
+			}
+			value = v
+		}
+		ms.SetMetric(metricName, value, sourceType(def.metricT))
+	}
+}
+
+// parseNumeric : parses numbers and durations reported as strings, durations are returned in milliseconds
+func parseNumeric(s string) (float64, error) {
+	if v, err := strconv.ParseFloat(s, 64); err == nil {
+		return v, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	return float64(d) / float64(time.Millisecond), nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/newrelic/infra-integrations-sdk/sdk"
+	"github.com/stretchr/testify/assert"
+)
+
+var clusterPoolJSON = `{
+	"name": "default",
+	"clusterName": "prod-east",
+	"balanced": true,
+	"rebalanceStatus": "none",
+	"memoryQuota": 2048,
+	"indexMemoryQuota": 512,
+	"ftsMemoryQuota": 256,
+	"storageTotals": {
+		"ram": {"total": 8000, "quotaTotal": 4000, "quotaUsed": 1000, "used": 6000, "usedByData": 500},
+		"hdd": {"total": 90000, "quotaTotal": 90000, "used": 30000, "usedByData": 2000, "free": 60000}
+	},
+	"nodes": [
+		{"hostname": "10.0.0.1:8091", "status": "healthy"},
+		{"hostname": "10.0.0.2:8091", "status": "healthy"},
+		{"hostname": "10.0.0.3:8091", "status": "warmup"}
+	]
+}`
+
+func Test_PopulateClusterStats(t *testing.T) {
+	integration := &sdk.Integration{}
+
+	err := populateClusterStats(integration, []byte(clusterPoolJSON))
+
+	assert.Nil(t, err)
+	assert.Len(t, integration.Metrics, 1)
+	ms := integration.Metrics[0]
+	assert.Equal(t, "CouchbaseClusterSample", ms["event_type"])
+	assert.Equal(t, float64(4000), ms["ram.quotaTotal"])
+	assert.Equal(t, float64(1000), ms["ram.quotaUsed"])
+	assert.Equal(t, float64(60000), ms["hdd.free"])
+	assert.Equal(t, float64(256), ms["ftsMemoryQuota"])
+	assert.Equal(t, "none", ms["rebalanceStatus"])
+	assert.Equal(t, 1, ms["balanced"])
+	assert.Equal(t, 3, ms["nodes.total"])
+	assert.Equal(t, 2, ms["nodes.healthy"])
+	assert.Equal(t, 1, ms["nodes.warmup"])
+	assert.Equal(t, 0, ms["nodes.unhealthy"])
+	assert.NotContains(t, ms, "cbasMemoryQuota")
+}
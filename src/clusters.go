@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/metric"
+	"github.com/newrelic/infra-integrations-sdk/sdk"
+)
+
+// clusterConfig : a cluster of the cluster list file, settings left out are taken from the arguments
+type clusterConfig struct {
+	Name     string `json:"name"`
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	SSL      *bool  `json:"ssl"`
+	Bucket   string `json:"bucket"`
+	Node     string `json:"node"`
+
+	Network    string `json:"network"`
+	AddressMap string `json:"address_map"`
+
+	PasswordEnv     string `json:"password_env"`
+	PasswordFile    string `json:"password_file"`
+	PasswordCommand string `json:"password_command"`
+
+	CABundle           string `json:"ca_bundle"`
+	ServerName         string `json:"server_name"`
+	MinTLSVersion      string `json:"min_tls_version"`
+	ClientCert         string `json:"client_cert"`
+	ClientKey          string `json:"client_key"`
+	InsecureSkipVerify *bool  `json:"insecure_skip_verify"`
+}
+
+type clusterList struct {
+	Clusters []clusterConfig `json:"clusters"`
+}
+
+// loadClusterList : a cluster list setting a password must be readable by its owner only, like a password file
+func loadClusterList(path string) ([]clusterConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var list clusterList
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("invalid cluster list: %v", err)
+	}
+	if len(list.Clusters) == 0 {
+		return nil, fmt.Errorf("no cluster in cluster list %s", path)
+	}
+	names := map[string]bool{}
+	for i, c := range list.Clusters {
+		name := strings.TrimSpace(c.Name)
+		if name == "" {
+			return nil, fmt.Errorf("cluster %d of the cluster list has no name", i+1)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("cluster '%s' is listed twice", name)
+		}
+		if strings.TrimSpace(c.Host) == "" {
+			return nil, fmt.Errorf("cluster '%s' has no host", name)
+		}
+		names[name] = true
+		list.Clusters[i].Name = name
+	}
+	for _, c := range list.Clusters {
+		if c.Password == "" {
+			continue
+		}
+		if err := checkPrivateFile("cluster list", path); err != nil {
+			return nil, fmt.Errorf("cluster '%s' sets a password: %v", c.Name, err)
+		}
+		break
+	}
+	return list.Clusters, nil
+}
+
+// populateClusters : collects the listed clusters one after the other, with the settings of the arguments restored in between.
+// Each cluster gets its own share of the time left, so a hung cluster doesn't starve the ones after it.
+// Samples are tagged with the cluster name and inventory keys prefixed with it.
+func populateClusters(ctx context.Context, integration *sdk.Integration, clusters []clusterConfig) {
+	defaults := args
+	defer func() { args = defaults }()
+	for i, c := range clusters {
+		args = defaults
+		first := len(integration.Metrics)
+		inventory := sdk.Inventory{}
+		clusterCtx, cancel := clusterContext(ctx, len(clusters)-i)
+		if err := useCluster(c); err != nil {
+			setCollectionErrors(integration, []error{err})
+		} else {
+			populate(clusterCtx, integration, inventory)
+		}
+		cancel()
+
+		for _, ms := range integration.Metrics[first:] {
+			ms.SetMetric("cluster", c.Name, metric.ATTRIBUTE)
+		}
+		for key, item := range inventory {
+			integration.Inventory[c.Name+"/"+key] = item
+		}
+	}
+}
+
+// clusterContext : splits the time left before the deadline of ctx evenly between the clusters left,
+// the time a cluster doesn't use goes to the ones after it
+func clusterContext(ctx context.Context, left int) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok || left < 1 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, time.Until(deadline)/time.Duration(left))
+}
+
+// useCluster : points the connection globals, the TLS and network settings and the bucket and node filters at c
+func useCluster(c clusterConfig) error {
+	args.Host = c.Host
+	if c.Port != 0 {
+		args.Port = c.Port
+	}
+	if c.Username != "" {
+		args.Username = c.Username
+	}
+	// a password source of the cluster replaces the one of the arguments
+	if c.Password != "" || c.PasswordEnv != "" || c.PasswordFile != "" || c.PasswordCommand != "" {
+		args.Password, args.PasswordEnv, args.PasswordFile, args.PasswordCommand = c.Password, c.PasswordEnv, c.PasswordFile, c.PasswordCommand
+	}
+	if c.SSL != nil {
+		args.SSL = *c.SSL
+	}
+	if c.Bucket != "" {
+		args.Bucket = c.Bucket
+	}
+	if c.Node != "" {
+		args.Node = c.Node
+	}
+	if c.Network != "" {
+		args.Network = c.Network
+	}
+	if c.AddressMap != "" {
+		args.AddressMap = c.AddressMap
+	}
+	if c.CABundle != "" {
+		args.CABundle = c.CABundle
+	}
+	if c.ServerName != "" {
+		args.ServerName = c.ServerName
+	}
+	if c.MinTLSVersion != "" {
+		args.MinTLSVersion = c.MinTLSVersion
+	}
+	if c.ClientCert != "" {
+		args.ClientCert = c.ClientCert
+	}
+	if c.ClientKey != "" {
+		args.ClientKey = c.ClientKey
+	}
+	if c.InsecureSkipVerify != nil {
+		args.InsecureSkipVerify = *c.InsecureSkipVerify
+	}
+	return initConnection()
+}
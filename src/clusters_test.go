@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/sdk"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeClusterList(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "couchbase-plugin-clusters")
+	assert.Nil(t, err)
+	path := filepath.Join(dir, "clusters.json")
+	assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func Test_LoadClusterList(t *testing.T) {
+	path := writeClusterList(t, `{"clusters": [
+		{"name": " eu ", "host": "couchbase://h1,h2", "username": "monitor", "ssl": true, "bucket": "beer"},
+		{"name": "us", "host": "h3"}
+	]}`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	clusters, err := loadClusterList(path)
+	assert.Nil(t, err)
+	assert.Len(t, clusters, 2)
+	assert.Equal(t, "eu", clusters[0].Name)
+	assert.True(t, *clusters[0].SSL)
+	assert.Nil(t, clusters[1].SSL)
+
+	for _, invalid := range []string{
+		`{"clusters": []}`,
+		`{"clusters": [{"host": "h1"}]}`,
+		`{"clusters": [{"name": "eu"}]}`,
+		`{"clusters": [{"name": "eu", "host": "h1"}, {"name": "eu", "host": "h2"}]}`,
+		`not json`,
+	} {
+		path := writeClusterList(t, invalid)
+		_, err := loadClusterList(path)
+		assert.NotNil(t, err, invalid)
+		os.RemoveAll(filepath.Dir(path))
+	}
+}
+
+// restoreConnection : useCluster points the arguments and the connection globals at each cluster, the returned func restores them
+func restoreConnection() func() {
+	a, client, url, seeds, scope := args, httpClient, baseURL, seedURLs, clusterScope
+	user, pass, net, addresses := username, password, network, addressMap
+	return func() {
+		args, httpClient, baseURL, seedURLs, clusterScope = a, client, url, seeds, scope
+		username, password, network, addressMap = user, pass, net, addresses
+	}
+}
+
+func Test_LoadClusterListWithPasswordMustBePrivate(t *testing.T) {
+	path := writeClusterList(t, `{"clusters": [{"name": "eu", "host": "h1"}, {"name": "us", "host": "h2", "password": "secret"}]}`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	_, err := loadClusterList(path)
+	assert.Nil(t, err)
+
+	assert.Nil(t, os.Chmod(path, 0644))
+	_, err = loadClusterList(path)
+	assert.EqualError(t, err, "cluster 'us' sets a password: cluster list "+path+" is accessible by other users, its mode must be 0600 or 0400, got 0644")
+
+	// without inline passwords the list holds no secret
+	assert.Nil(t, ioutil.WriteFile(path, []byte(`{"clusters": [{"name": "us", "host": "h2", "password_file": "/etc/couchbase-us"}]}`), 0644))
+	_, err = loadClusterList(path)
+	assert.Nil(t, err)
+}
+
+func Test_PopulateClustersTagsSamples(t *testing.T) {
+	var authorized string
+	eu := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _, _ := r.BasicAuth()
+		authorized = user
+		switch r.URL.Path {
+		case "/pools":
+			w.Write([]byte(poolsJSON))
+		case "/pools/default":
+			w.Write([]byte(defaultPoolJSON))
+		case "/pools/default/buckets":
+			w.Write([]byte(bucketsJSON))
+		}
+	}))
+	defer eu.Close()
+	us := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(401)
+	}))
+	defer us.Close()
+
+	defer restoreConnection()()
+	args.Inventory, args.Metrics, args.Retries = true, false, 0
+	args.Username, args.Bucket, args.MinTLSVersion, args.Network = "default-user", "all", "1.2", "default"
+
+	integration := &sdk.Integration{Inventory: sdk.Inventory{}}
+	populateClusters(context.Background(), integration, []clusterConfig{
+		{Name: "eu", Host: eu.URL[len("http://"):], Username: "eu-user"},
+		{Name: "us", Host: us.URL[len("http://"):]},
+	})
+
+	assert.Equal(t, "eu-user", authorized)
+	assert.Equal(t, "default-user", args.Username)
+	assert.Contains(t, integration.Inventory, "eu/cluster")
+	assert.NotContains(t, integration.Inventory, "cluster")
+	assert.Len(t, integration.Metrics, 3)
+	for _, ms := range integration.Metrics {
+		assert.Equal(t, "CouchbaseCollectionErrorSample", ms["event_type"])
+		assert.Equal(t, "us", ms["cluster"])
+		assert.Equal(t, "auth", ms["errorType"])
+	}
+}
+
+func Test_PopulateClustersHungClusterKeepsItsShare(t *testing.T) {
+	hung := make(chan struct{})
+	stuck := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-hung:
+		case <-r.Context().Done():
+		}
+	}))
+	defer stuck.Close()
+	defer close(hung)
+	eu := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/pools":
+			w.Write([]byte(poolsJSON))
+		case "/pools/default":
+			w.Write([]byte(defaultPoolJSON))
+		case "/pools/default/buckets":
+			w.Write([]byte(bucketsJSON))
+		}
+	}))
+	defer eu.Close()
+
+	defer restoreConnection()()
+	args.Inventory, args.Metrics, args.Retries = true, false, 0
+	args.Bucket, args.MinTLSVersion, args.Network = "all", "1.2", "default"
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	integration := &sdk.Integration{Inventory: sdk.Inventory{}}
+	populateClusters(ctx, integration, []clusterConfig{
+		{Name: "stuck", Host: stuck.URL[len("http://"):]},
+		{Name: "eu", Host: eu.URL[len("http://"):]},
+	})
+
+	assert.Nil(t, ctx.Err())
+	assert.Contains(t, integration.Inventory, "eu/cluster")
+	assert.Contains(t, integration.Inventory, "eu/bucket/travel-sample")
+	for _, ms := range integration.Metrics {
+		assert.Equal(t, "stuck", ms["cluster"])
+	}
+}
+
+func Test_ClusterContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	clusterCtx, clusterCancel := clusterContext(ctx, 3)
+	defer clusterCancel()
+	deadline, ok := clusterCtx.Deadline()
+	assert.True(t, ok)
+	assert.InDelta(t, float64(20*time.Second), float64(time.Until(deadline)), float64(time.Second))
+
+	clusterCtx, clusterCancel = clusterContext(context.Background(), 3)
+	defer clusterCancel()
+	_, ok = clusterCtx.Deadline()
+	assert.False(t, ok)
+}
@@ -2,11 +2,12 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"fmt"
-	"io/ioutil"
-	"net/http"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	sdkArgs "github.com/newrelic/infra-integrations-sdk/args"
@@ -17,20 +18,53 @@ import (
 
 type argumentList struct {
 	sdkArgs.DefaultArgumentList
-	Host     string `default:"localhost" help:"Hostname or IP of the Couchbase server"`
+	Host     string `default:"localhost" help:"Hostname or IP of the Couchbase server, a comma separated list of seed hosts or a couchbase:// connection string"`
 	Port     int    `default:"8091" help:"Port of the Couchbase server"`
 	Username string `default:"" help:"Username for authenticating to Couchbase server"`
 	Password string `default:"" help:"Password for authenticating to the Couchbase server"`
 	SSL      bool   `default:"false" help:"Use SSL connection to Couchbase server"`
 	Bucket   string `default:"all" help:"(OPTIONAL) If specified, only the specified bucket stats will be fetched"`
 	Node     string `default:"all" help:"(OPTIONAL) If specified, only the specified node will be queried"`
+
+	PasswordEnv     string `default:"" help:"(OPTIONAL) Name of the environment variable holding the password"`
+	PasswordFile    string `default:"" help:"(OPTIONAL) Path of a file holding the password, readable by its owner only"`
+	PasswordCommand string `default:"" help:"(OPTIONAL) Command printing the password, run without a shell"`
+
+	CABundle           string `default:"" help:"(OPTIONAL) Path of a PEM bundle of the CAs trusted to sign the Couchbase server certificates, the system CAs are used otherwise"`
+	ServerName         string `default:"" help:"(OPTIONAL) Name verified against the Couchbase server certificates instead of the host"`
+	MinTLSVersion      string `default:"1.2" help:"Minimum TLS version: 1.0, 1.1, 1.2 or 1.3"`
+	ClientCert         string `default:"" help:"(OPTIONAL) Path of a PEM client certificate for x.509 authentication, requires client_key"`
+	ClientKey          string `default:"" help:"(OPTIONAL) Path of the PEM private key of client_cert"`
+	InsecureSkipVerify bool   `default:"false" help:"Do not verify the Couchbase server certificates. Insecure, for testing only"`
+
+	Concurrency     int `default:"8" help:"Maximum number of concurrent REST requests"`
+	NodeConcurrency int `default:"2" help:"Maximum number of concurrent REST requests against a single node"`
+	Retries         int `default:"2" help:"Number of times a failed GET request is retried"`
+	RetryBackoff    int `default:"200" help:"Milliseconds before the first retry, doubled on every further retry"`
+	Deadline        int `default:"25" help:"Seconds after which the run stops collecting and publishes what was collected, 0 for no deadline"`
+
+	StatePath    string `default:"/tmp/nr-couchbase-plugin" help:"Directory where state is kept between runs"`
+	StateTTL     int    `default:"3600" help:"Seconds after which counters no longer reported are dropped from the state"`
+	StatsBackend string `default:"auto" help:"Bucket stats source: legacy per bucket stats, range for the Couchbase 7 stats API, prometheus to scrape each node /metrics endpoint, or auto to pick by server version"`
+
+	PrometheusFamilies string `default:"kv_,n1ql_,index_,fts_,eventing_" help:"Comma separated metric family prefixes reported by the prometheus stats backend, which only scrapes the /metrics endpoint of the management port of each node"`
+	MetricsConfig      string `default:"nr-couchbase-plugin-metrics.json" help:"Path of the JSON metric catalogue listing the bucket stats and derived metrics, a relative path not found in the working directory is looked up in the integration directory"`
+	Zoom               string `default:"minute" help:"Time span of the bucket stats samples: minute or hour"`
+	RawSamples         string `default:"" help:"(OPTIONAL) Comma separated bucket stats also reported once per sample, with the sample timestamp, as CouchbaseRawSample by the legacy and range stats backends"`
+	Network            string `default:"default" help:"Node addresses used for per node requests: default for the addresses reported by the cluster, external for their external alternate addresses, or auto to use the external ones when host is an external address"`
+	AddressMap         string `default:"" help:"(OPTIONAL) Comma separated internal=external rewrites of the node addresses, as host:port or host"`
+	Clusters           string `default:"" help:"(OPTIONAL) Path of a JSON cluster list, every listed cluster is collected and its samples tagged with the cluster name"`
 }
 
 type metricType int
 
 type metricDef struct {
-	metricT metricType
-	metricN string
+	metricT     metricType
+	metricN     string
+	path        string
+	unit        string
+	aggregation string
+	rangeStat   *rangeStat
 }
 
 type statsEndpoint struct {
@@ -50,10 +84,7 @@ const (
 
 var args argumentList
 
-var transport = &http.Transport{
-	TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-}
-var httpClient = &http.Client{Transport: transport, Timeout: 10 * time.Second}
+var httpClient = newHTTPClient(&tls.Config{MinVersion: tls.VersionTLS12})
 
 var baseURL string
 
@@ -63,52 +94,62 @@ var password string
 
 var listBuckets []string
 
-var configuredMetrics = map[string]metricDef{
-	"cmd_get":                         metricDef{gauge, ""},
-	"cmd_set":                         metricDef{gauge, ""},
-	"delete_hits":                     metricDef{gauge, ""},
-	"ep_cache_miss_rate":              metricDef{gauge, ""},
-	"couch_docs_fragmentation":        metricDef{gauge, ""},
-	"couch_views_fragmentation":       metricDef{gauge, ""},
-	"curr_connections":                metricDef{gauge, ""},
-	"ep_dcp_replica_items_remaining":  metricDef{gauge, ""},
-	"ep_dcp_2i_items_remaining":       metricDef{gauge, ""},
-	"ep_dcp_views_items_remaining":    metricDef{gauge, ""},
-	"ep_dcp_replica_backoff":          metricDef{gauge, ""},
-	"ep_dcp_xdcr_backoff":             metricDef{gauge, ""},
-	"vb_avg_total_queue_age":          metricDef{gauge, ""},
-	"ep_oom_errors":                   metricDef{gauge, ""},
-	"ep_tmp_oom_errors":               metricDef{gauge, ""},
-	"vb_active_resident_items_ratio":  metricDef{gauge, ""},
-	"vb_replica_resident_items_ratio": metricDef{gauge, ""},
-	//percent_quota_utilization: mem_used / ep_mem_high_wat
-	"mem_used":        metricDef{gauge, ""},
-	"ep_mem_high_wat": metricDef{gauge, ""},
-	//percent_metadata_utilization: ep_meta_data_memory / ep_mem_high_wat
-	"ep_meta_data_memory": metricDef{gauge, ""},
-	//disk_write_queue: ep_queue_size + ep_flusher_todo
-	"ep_queue_size":   metricDef{gauge, ""},
-	"ep_flusher_todo": metricDef{gauge, ""},
-	//total_ops: cmd_get + cmd_set + incr_misses + incr_hits + decr_misses + decr_hits + delete_misses + delete_hits
-	"incr_misses":   metricDef{gauge, ""},
-	"incr_hits":     metricDef{gauge, ""},
-	"decr_misses":   metricDef{gauge, ""},
-	"decr_hits":     metricDef{gauge, ""},
-	"delete_misses": metricDef{gauge, ""},
-}
+var metricSetLock sync.Mutex
+
+// configuredMetrics : the bucket stats of the metric catalogue, loaded by main
+var configuredMetrics = map[string]metricDef{}
 
 func main() {
 	integration, err := sdk.NewIntegration(integrationName, integrationVersion, &args)
 	fatalIfErr(err)
+	var clusters []clusterConfig
+	if args.Clusters != "" {
+		clusters, err = loadClusterList(args.Clusters)
+		fatalIfErr(err)
+	} else {
+		fatalIfErr(initConnection())
+	}
+
+	if _, ok := zoomWindows[strings.TrimSpace(args.Zoom)]; !ok {
+		fatalIfErr(fmt.Errorf("unknown zoom '%s'", args.Zoom))
+	}
+	configuredMetrics, configuredDerivedMetrics, err = loadMetricCatalogue(cataloguePath(args.MetricsConfig))
+	fatalIfErr(err)
+
+	ctx := context.Background()
+	if args.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(args.Deadline)*time.Second)
+		defer cancel()
+	}
+
+	if clusters != nil {
+		populateClusters(ctx, integration, clusters)
+	} else {
+		populate(ctx, integration, integration.Inventory)
+	}
+	fatalIfErr(integration.Publish())
+}
 
+// populate : collects the cluster the connection globals point at,
+// failed collection steps are reported with whatever was collected
+func populate(ctx context.Context, integration *sdk.Integration, inventory sdk.Inventory) {
+	if err := selectSeed(ctx); err != nil {
+		setCollectionErrors(integration, []error{err})
+	}
+	if err := resolveClusterScope(ctx); err != nil {
+		log.Debug("Keeping the state under the seed hosts, the cluster uuid is not available: %v", err)
+	}
+	if err := resolveNodeAddresses(ctx); err != nil {
+		setCollectionErrors(integration, []error{err})
+	}
 	if args.All || args.Inventory {
-		fatalIfErr(populateInventory(integration.Inventory))
+		setCollectionErrors(integration, populateInventory(ctx, inventory))
 	}
 
 	if args.All || args.Metrics {
-		fatalIfErr(populateMetrics(integration))
+		setCollectionErrors(integration, populateMetrics(ctx, integration))
 	}
-	fatalIfErr(integration.Publish())
 }
 
 func fatalIfErr(err error) {
@@ -117,93 +158,189 @@ func fatalIfErr(err error) {
 	}
 }
 
-func populateInventory(inventory sdk.Inventory) error {
-	// Insert here the logic of your integration to get the inventory data
-	// Ex: inventory.SetItem("softwareVersion", "value", "1.0.1")
-	// --
-	return nil
+func initConnection() error {
+	seeds, ssl, err := parseSeeds(args.Host, args.Port, args.SSL)
+	if err != nil {
+		return err
+	}
+	args.SSL = ssl
+	if err := configureHTTPClient(); err != nil {
+		return err
+	}
+	seedURLs = seeds
+	baseURL = seeds[0]
+	clusterScope = strings.Join(seeds, ",")
+	network = strings.TrimSpace(args.Network)
+	if option := connectionOption(args.Host, "network"); option != "" && network == defaultNetwork {
+		network = option
+	}
+	if network != defaultNetwork && network != externalNetwork && network != autoNetwork {
+		return fmt.Errorf("unknown network '%s'", network)
+	}
+	if addressMap, err = parseAddressMap(args.AddressMap); err != nil {
+		return err
+	}
+	username = strings.TrimSpace(args.Username)
+	password, err = resolvePassword()
+	return err
 }
 
-func populateMetrics(integration *sdk.Integration) error {
-	protocol := "http://"
-	if args.SSL {
-		protocol = "https://"
+// populateMetrics : collects everything it can, the failed steps are returned and reported by the caller
+func populateMetrics(ctx context.Context, integration *sdk.Integration) []error {
+	var errs []error
+	backend, err := selectStatsBackend(ctx, strings.TrimSpace(args.StatsBackend))
+	if err != nil {
+		errs = append(errs, collectionFailure("/pools", "", "", err))
+		backend = legacyBackend
 	}
-	baseURL = fmt.Sprintf("%s%s%s%d", protocol, args.Host, ":", args.Port)
-	username = strings.TrimSpace(args.Username)
-	password = strings.TrimSpace(args.Password)
 
-	bucketArg := strings.TrimSpace(args.Bucket)
-	if bucketArg == "all" {
-		// get all bucket names
-		req, err := http.NewRequest("GET", baseURL+"/pools/default/buckets", nil)
+	if backend == prometheusBackend && len(rawSampleMetrics()) > 0 {
+		log.Warn("raw_samples is not supported by the prometheus stats backend, no CouchbaseRawSample is reported")
+	}
+	var cursors *sampleCursors
+	if backend == legacyBackend || backend == rangeBackend {
+		cursors, err = loadSampleCursors()
 		if err != nil {
-			return err
+			errs = append(errs, collectionFailure(statePath(sampleCursorsState), "", "", err))
 		}
-		req.SetBasicAuth(username, password)
-		bucketsResponse, err := httpClient.Do(req)
+	}
+	counters, err := loadCounterStore(time.Duration(args.StateTTL) * time.Second)
+	if err != nil {
+		errs = append(errs, collectionFailure(statePath(countersState), "", "", err))
+	}
+
+	pool := newWorkerPool(ctx, args.Concurrency, args.NodeConcurrency)
+	pool.Go(seedNode(), func() error {
+		poolData, err := httpGet(ctx, "/pools/default")
 		if err != nil {
-			return err
+			return collectionFailure("/pools/default", "", "", err)
+		}
+		var failed collectionErrors
+		if err := populateClusterStats(integration, poolData); err != nil {
+			failed = append(failed, collectionFailure("/pools/default", "", "", err))
+		}
+		if err := populateNodeStats(integration, poolData, strings.TrimSpace(args.Node)); err != nil {
+			failed = append(failed, collectionFailure("/pools/default", "", strings.TrimSpace(args.Node), err))
+		}
+		if backend == prometheusBackend {
+			err = schedulePrometheusStats(ctx, pool, integration, counters, poolData)
+		} else {
+			err = scheduleServiceStats(ctx, pool, integration, poolData)
+		}
+		if err != nil {
+			failed = append(failed, collectionFailure("/pools/default", "", "", err))
+		}
+		if len(failed) > 0 {
+			return failed
+		}
+		return nil
+	})
+	pool.Go(seedNode(), func() error {
+		tasksData, err := httpGet(ctx, "/pools/default/tasks")
+		if err != nil {
+			return collectionFailure("/pools/default/tasks", "", "", err)
+		}
+		var failed collectionErrors
+		if err := populateTaskStats(integration, tasksData); err != nil {
+			failed = append(failed, collectionFailure("/pools/default/tasks", "", "", err))
 		}
-		bucketsData, err := ioutil.ReadAll(bucketsResponse.Body)
-		defer bucketsResponse.Body.Close()
+		if err := populateXdcrStats(ctx, pool, integration, backend, tasksData); err != nil {
+			failed = append(failed, collectionFailure("/pools/default/remoteClusters", "", "", err))
+		}
+		if len(failed) > 0 {
+			return failed
+		}
+		return nil
+	})
+	switch backend {
+	case rangeBackend:
+		pool.Go(seedNode(), func() error {
+			err := populateRangeStats(ctx, integration, cursors, counters, strings.TrimSpace(args.Bucket), strings.TrimSpace(args.Node))
+			return collectionFailure("/pools/default/stats/range", "", "", err)
+		})
+	case legacyBackend:
+		pool.Go(seedNode(), func() error {
+			return scheduleBucketStats(ctx, pool, integration, cursors, counters)
+		})
+	}
+	errs = append(errs, pool.Wait()...)
+	if cursors != nil {
+		if err := cursors.save(); err != nil {
+			errs = append(errs, collectionFailure(statePath(sampleCursorsState), "", "", err))
+		}
+	}
+	if err := counters.save(time.Now()); err != nil {
+		errs = append(errs, collectionFailure(statePath(countersState), "", "", err))
+	}
+	return errs
+}
+
+func scheduleBucketStats(ctx context.Context, pool *workerPool, integration *sdk.Integration, cursors *sampleCursors, counters *counterStore) error {
+	bucketArg := strings.TrimSpace(args.Bucket)
+	if bucketArg == "all" {
+		// get all bucket names
+		bucketsData, err := httpGet(ctx, "/pools/default/buckets")
 		if err != nil {
-			return err
+			return collectionFailure("/pools/default/buckets", "", "", err)
 		}
 
-		log.Debug("Reading bucket names" + string(bucketsData))
-		listBuckets = getAllBucketNames(bucketsData)
+		log.Debug("Reading bucket names")
+		listBuckets, err = getAllBucketNames(bucketsData)
+		if err != nil {
+			return collectionFailure("/pools/default/buckets", "", "", err)
+		}
 	} else {
 		listBuckets = []string{bucketArg}
 	}
 
-	var statEndpoints []statsEndpoint
 	nodeArg := strings.TrimSpace(args.Node)
-	if nodeArg == "all" {
-		for _, bucketName := range listBuckets {
-			log.Debug("Reading nodes for bucket: " + bucketName)
-			req, err := http.NewRequest("GET", baseURL+"/pools/default/buckets/"+bucketName+"/nodes", nil)
+	for _, bucketName := range listBuckets {
+		bucketName := bucketName
+		if nodeArg != "all" {
+			statsURI := fmt.Sprintf("%s%s%s%s%s", "/pools/default/buckets/", bucketName, "/nodes/", nodeArg, "/stats")
+			scheduleStats(ctx, pool, integration, cursors, counters, statsEndpoint{uri: statsURI, bucket: bucketName, node: nodeArg})
+			continue
+		}
+		pool.Go(seedNode(), func() error {
+			log.Debug("Reading nodes for bucket: %s", bucketName)
+			nodesURI := "/pools/default/buckets/" + bucketName + "/nodes"
+			bucketsByNodesData, err := httpGet(ctx, nodesURI)
 			if err != nil {
-				return err
+				return collectionFailure(nodesURI, bucketName, "", err)
 			}
-			req.SetBasicAuth(username, password)
-
-			bucketsByNodesResponse, err := httpClient.Do(req)
-			if err != nil {
-				return err
+			var statEndpoints []statsEndpoint
+			if err := getAllStatsEndpoints(bucketsByNodesData, bucketName, &statEndpoints); err != nil {
+				return collectionFailure(nodesURI, bucketName, "", err)
 			}
-			bucketsByNodesData, _ := ioutil.ReadAll(bucketsByNodesResponse.Body)
-			defer bucketsByNodesResponse.Body.Close()
-			getAllStatsEndpoints(bucketsByNodesData, bucketName, &statEndpoints)
-		}
-	} else {
-		for _, bucketName := range listBuckets {
-			log.Debug("Reading nodes for bucket: " + bucketName)
-			statsURI := fmt.Sprintf("%s%s%s%s%s", "/pools/default/buckets/", bucketName, "/nodes/", nodeArg, "/stats")
-			statEndpoints = append(statEndpoints, statsEndpoint{uri: statsURI, bucket: bucketName, node: nodeArg})
-		}
+			for _, ep := range statEndpoints {
+				scheduleStats(ctx, pool, integration, cursors, counters, ep)
+			}
+			return nil
+		})
 	}
+	return nil
+}
 
-	for _, ep := range statEndpoints {
-		log.Debug("Processing metrics at " + ep.uri)
-		req, err := http.NewRequest("GET", baseURL+ep.uri, nil)
+func scheduleStats(ctx context.Context, pool *workerPool, integration *sdk.Integration, cursors *sampleCursors, counters *counterStore, ep statsEndpoint) {
+	pool.Go(ep.node, func() error {
+		log.Debug("Processing metrics at %s", ep.uri)
+		statsData, err := httpGetURL(ctx, nodeURL(ep.node)+withZoom(ep.uri, strings.TrimSpace(args.Zoom)))
 		if err != nil {
-			return err
+			return collectionFailure(ep.uri, ep.bucket, ep.node, err)
 		}
-		req.SetBasicAuth(username, password)
+		err = populateStats(integration, cursors, counters, ep.bucket, ep.node, statsData)
+		return collectionFailure(ep.uri, ep.bucket, ep.node, err)
+	})
+}
 
-		statsResponse, err := httpClient.Do(req)
-		if err != nil {
-			return err
-		}
-		statsData, _ := ioutil.ReadAll(statsResponse.Body)
-		defer statsResponse.Body.Close()
-		populateStats(integration, ep.bucket, ep.node, statsData)
-	}
-	return nil
+// newMetricSet : integration.NewMetricSet is not safe for concurrent use
+func newMetricSet(integration *sdk.Integration, eventType string) *metric.MetricSet {
+	metricSetLock.Lock()
+	defer metricSetLock.Unlock()
+	return integration.NewMetricSet(eventType)
 }
 
-func getAllBucketNames(data []byte) []string {
+func getAllBucketNames(data []byte) ([]string, error) {
 	var bucketnames []string
 	config := Config{
 		Properties: []Property{
@@ -212,13 +349,12 @@ func getAllBucketNames(data []byte) []string {
 	}
 	err := PickDeserializedUsingConfig(bytes.NewReader(data), config, "name", &bucketnames)
 	if err != nil {
-		log.Fatal(err)
-		return []string{}
+		return []string{}, err
 	}
-	return bucketnames
+	return bucketnames, nil
 }
 
-func getAllStatsEndpoints(data []byte, bucketname string, ep *[]statsEndpoint) {
+func getAllStatsEndpoints(data []byte, bucketname string, ep *[]statsEndpoint) error {
 
 	statsUriAlias := "statsUris"
 	hostnameAlias := "hostNames"
@@ -235,46 +371,102 @@ func getAllStatsEndpoints(data []byte, bucketname string, ep *[]statsEndpoint) {
 
 	err := PickDeserializedUsingConfig(bytes.NewReader(data), config, "", &result)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	if len(result.StatsUris) != len(result.Hostnames) {
+		return fmt.Errorf("%d stats uris for %d nodes", len(result.StatsUris), len(result.Hostnames))
 	}
 	for i, _ := range result.Hostnames {
 		*ep = append(*ep, statsEndpoint{uri: result.StatsUris[i], bucket: bucketname, node: result.Hostnames[i]})
 	}
+	return nil
 }
 
-func populateStats(integration *sdk.Integration, bucketName string, hostName string, statsData []byte) {
-	ms := integration.NewMetricSet("CouchbaseSample")
+// populateStats : the stats missing from statsData are skipped and returned as an error once the others are set
+func populateStats(integration *sdk.Integration, cursors *sampleCursors, counters *counterStore, bucketName string, hostName string, statsData []byte) error {
+	timestamps, indexes := cursors.newSamples(bucketName, hostName, statsData)
+	if timestamps != nil && len(indexes) == 0 {
+		log.Debug("No new samples for bucket %s on %s since the previous run", bucketName, hostName)
+		return nil
+	}
+	ms := newMetricSet(integration, "CouchbaseSample")
 	ms.SetMetric("bucket", bucketName, metric.ATTRIBUTE)
 	ms.SetMetric("node", hostName, metric.ATTRIBUTE)
 
+	sampledAt := time.Now()
+	if len(timestamps) > 0 {
+		sampledAt = time.Unix(0, int64(timestamps[len(timestamps)-1])*int64(time.Millisecond))
+	}
+
+	values := map[string]float64{}
+	missing := []string{}
 	for metricName, metricDef := range configuredMetrics {
-		var sumMetricSamples float64
-		var countMetricSamples float64
 		metrics := []float64{}
-		metricPath := fmt.Sprintf("op/samples/%s", metricName)
 		config := Config{
 			Properties: []Property{
-				{Path: metricPath, Type: "[f]"},
+				{Path: metricDef.statsPath(metricName), Type: "[f]"},
 			},
 		}
 		err := PickDeserializedUsingConfig(bytes.NewReader(statsData), config, metricName, &metrics)
 		if err != nil {
-			log.Fatal(err)
+			log.Debug("Skipping %s: %v", metricName, err)
+			missing = append(missing, metricName)
+			continue
 		}
-		for _, m := range metrics {
-			sumMetricSamples = sumMetricSamples + m
-			countMetricSamples++
+		metricValue, ok := aggregate(metricDef.aggregation, selectSamples(metrics, timestamps, indexes))
+		if !ok {
+			log.Debug("No samples for %s", metricName)
+			continue
 		}
-		metricValue := sumMetricSamples / countMetricSamples
-		switch metricDef.metricT {
-		case gauge:
-			ms.SetMetric(metricName, metricValue, metric.GAUGE)
-		case delta:
-			ms.SetMetric(metricName, metricValue, metric.DELTA)
-		case rate:
-			ms.SetMetric(metricName, metricValue, metric.RATE)
-		case attribute:
-			ms.SetMetric(metricName, metricValue, metric.ATTRIBUTE)
+		setBucketMetric(ms, counters, bucketName, hostName, metricName, metricDef, metricValue, sampledAt, values)
+	}
+	setDerivedMetrics(ms, values, configuredDerivedMetrics)
+	if names := rawSampleMetrics(); len(names) > 0 {
+		setRawSamples(integration, bucketName, hostName, statsData, timestamps, indexes, names)
+	}
+	if len(timestamps) > 0 {
+		cursors.advance(bucketName, hostName, timestamps[len(timestamps)-1])
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("missing stats %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// setBucketMetric : delta and rate metrics are computed against the value of the previous run and reported as gauges
+func setBucketMetric(ms *metric.MetricSet, counters *counterStore, bucketName string, hostName string, metricName string, def metricDef, value float64, at time.Time, values map[string]float64) {
+	name := def.reportedName(metricName)
+	key := counterKey(clusterScope, bucketName, hostName, metricName)
+	switch def.metricT {
+	case delta:
+		d, ok := counters.delta(key, value, at)
+		if !ok {
+			return
+		}
+		ms.SetMetric(name, d, metric.GAUGE)
+		values[name] = d
+	case rate:
+		r, ok := counters.rate(key, value, at)
+		if !ok {
+			return
 		}
+		ms.SetMetric(name, r, metric.GAUGE)
+		values[name] = r
+	default:
+		ms.SetMetric(name, value, sourceType(def.metricT))
+		values[name] = value
+	}
+}
+
+func sourceType(t metricType) metric.SourceType {
+	switch t {
+	case delta:
+		return metric.DELTA
+	case rate:
+		return metric.RATE
+	case attribute:
+		return metric.ATTRIBUTE
 	}
+	return metric.GAUGE
 }
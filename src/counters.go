@@ -0,0 +1,90 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+const countersState = "counters"
+
+// counterState : the last value seen for a counter, when it was sampled by Couchbase and when the plugin
+// last saw it, in unix milliseconds. The sample timestamp comes from the server clock and only measures
+// rates, the expiry uses the local clock.
+type counterState struct {
+	Value     float64 `json:"value"`
+	Timestamp int64   `json:"timestamp"`
+	SeenAt    int64   `json:"seenAt"`
+}
+
+// counterStore : file backed store of counter values turning cumulative counters into per run deltas and rates
+type counterStore struct {
+	mu      sync.Mutex
+	entries map[string]counterState
+	ttl     time.Duration
+}
+
+// loadCounterStore : counters that can't be read are reported and the run starts without them
+func loadCounterStore(ttl time.Duration) (*counterStore, error) {
+	s := &counterStore{entries: map[string]counterState{}, ttl: ttl}
+	if _, err := loadState(countersState, &s.entries); err != nil {
+		s.entries = map[string]counterState{}
+		return s, err
+	}
+	return s, nil
+}
+
+func counterKey(cluster string, bucket string, node string, metricName string) string {
+	return strings.Join([]string{cluster, bucket, node, metricName}, "/")
+}
+
+// delta : change of the counter since the previous run, a counter lower than before was reset and its value is the delta.
+// ok is false the first time a counter is seen.
+func (s *counterStore) delta(key string, value float64, at time.Time) (float64, bool) {
+	d, _, ok := s.observe(key, value, at)
+	return d, ok
+}
+
+// rate : per second change of the counter since the previous run
+func (s *counterStore) rate(key string, value float64, at time.Time) (float64, bool) {
+	d, elapsed, ok := s.observe(key, value, at)
+	if !ok || elapsed <= 0 {
+		return 0, false
+	}
+	return d / elapsed.Seconds(), true
+}
+
+func (s *counterStore) observe(key string, value float64, at time.Time) (float64, time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous, found := s.entries[key]
+	s.entries[key] = counterState{Value: value, Timestamp: unixMillis(at), SeenAt: unixMillis(time.Now())}
+	if !found {
+		return 0, 0, false
+	}
+	elapsed := time.Duration(unixMillis(at)-previous.Timestamp) * time.Millisecond
+	if value < previous.Value {
+		return value, elapsed, true
+	}
+	return value - previous.Value, elapsed, true
+}
+
+// save : persists the counters, dropping the ones not seen for longer than the ttl, now is the local time
+func (s *counterStore) save(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, entry := range s.entries {
+		seenAt := entry.SeenAt
+		if seenAt == 0 {
+			seenAt = entry.Timestamp
+		}
+		if now.Sub(time.Unix(0, seenAt*int64(time.Millisecond))) > s.ttl {
+			delete(s.entries, key)
+		}
+	}
+	return saveState(countersState, s.entries)
+}
+
+func unixMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/metric"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_CounterStoreDeltaAndRate(t *testing.T) {
+	s := &counterStore{entries: map[string]counterState{}, ttl: time.Hour}
+	start := time.Unix(1500000000, 0)
+
+	_, ok := s.delta("a", 100, start)
+	assert.False(t, ok)
+	_, ok = s.rate("b", 100, start)
+	assert.False(t, ok)
+
+	d, ok := s.delta("a", 160, start.Add(30*time.Second))
+	assert.True(t, ok)
+	assert.Equal(t, float64(60), d)
+
+	r, ok := s.rate("b", 160, start.Add(30*time.Second))
+	assert.True(t, ok)
+	assert.Equal(t, float64(2), r)
+
+	// node restart resets the counter
+	d, ok = s.delta("a", 15, start.Add(60*time.Second))
+	assert.True(t, ok)
+	assert.Equal(t, float64(15), d)
+
+	_, ok = s.rate("b", 200, start.Add(30*time.Second))
+	assert.False(t, ok)
+}
+
+func Test_CounterStoreSaveExpiresStaleKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "couchbase-plugin-state")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer func(path string) { args.StatePath = path }(args.StatePath)
+	args.StatePath = dir
+
+	now := time.Now()
+	s, err := loadCounterStore(time.Hour)
+	assert.Nil(t, err)
+	// the sample timestamps come from the Couchbase server clock, hours behind the local one
+	s.delta("fresh", 1, now.Add(-3*time.Hour))
+	s.entries["stale"] = counterState{Value: 1, Timestamp: unixMillis(now), SeenAt: unixMillis(now.Add(-2 * time.Hour))}
+	s.entries["legacy"] = counterState{Value: 1, Timestamp: unixMillis(now.Add(-2 * time.Hour))}
+	assert.Nil(t, s.save(now))
+
+	loaded, err := loadCounterStore(time.Hour)
+	assert.Nil(t, err)
+	assert.Contains(t, loaded.entries, "fresh")
+	assert.NotContains(t, loaded.entries, "stale")
+	assert.NotContains(t, loaded.entries, "legacy")
+}
+
+func Test_SetBucketMetric(t *testing.T) {
+	s := &counterStore{entries: map[string]counterState{}, ttl: time.Hour}
+	start := time.Unix(1500000000, 0)
+	values := map[string]float64{}
+	ms := metric.NewMetricSet("CouchbaseSample")
+	ooms := metricDef{metricT: delta}
+	gets := metricDef{metricT: rate, metricN: "gets_per_second"}
+
+	setBucketMetric(&ms, s, "b", "n", "ep_oom_errors", ooms, 5, start, values)
+	setBucketMetric(&ms, s, "b", "n", "cmd_total_gets", gets, 1000, start, values)
+	assert.NotContains(t, ms, "ep_oom_errors")
+	assert.NotContains(t, ms, "gets_per_second")
+
+	setBucketMetric(&ms, s, "b", "n", "ep_oom_errors", ooms, 7, start.Add(10*time.Second), values)
+	setBucketMetric(&ms, s, "b", "n", "cmd_total_gets", gets, 1500, start.Add(10*time.Second), values)
+	setBucketMetric(&ms, s, "b", "n", "mem_used", metricDef{metricT: gauge}, 42, start, values)
+	assert.Equal(t, float64(2), ms["ep_oom_errors"])
+	assert.Equal(t, float64(50), ms["gets_per_second"])
+	assert.Equal(t, float64(42), ms["mem_used"])
+	assert.Equal(t, map[string]float64{"ep_oom_errors": 2, "gets_per_second": 50, "mem_used": 42}, values)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const passwordCommandTimeout = 10 * time.Second
+
+// resolvePassword : the password comes from exactly one of password, password_env, password_file or password_command
+func resolvePassword() (string, error) {
+	sources := 0
+	for _, source := range []string{args.Password, args.PasswordEnv, args.PasswordFile, args.PasswordCommand} {
+		if strings.TrimSpace(source) != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return "", fmt.Errorf("only one of password, password_env, password_file and password_command can be set")
+	}
+
+	switch {
+	case strings.TrimSpace(args.PasswordEnv) != "":
+		name := strings.TrimSpace(args.PasswordEnv)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("password environment variable %s is not set", name)
+		}
+		return strings.TrimSpace(value), nil
+	case strings.TrimSpace(args.PasswordFile) != "":
+		return readPasswordFile(strings.TrimSpace(args.PasswordFile))
+	case strings.TrimSpace(args.PasswordCommand) != "":
+		return runPasswordCommand(strings.TrimSpace(args.PasswordCommand))
+	}
+	return strings.TrimSpace(args.Password), nil
+}
+
+// readPasswordFile : the file must be a regular file only its owner can read or write
+func readPasswordFile(path string) (string, error) {
+	if err := checkPrivateFile("password file", path); err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// checkPrivateFile : a file holding a password must be a regular file readable by its owner only
+func checkPrivateFile(kind string, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s %s is not a regular file", kind, path)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("%s %s is accessible by other users, its mode must be 0600 or 0400, got %04o", kind, path, info.Mode().Perm())
+	}
+	return nil
+}
+
+// runPasswordCommand : runs command, split on spaces and without a shell, and reads the password from its output
+func runPasswordCommand(command string) (string, error) {
+	fields := strings.Fields(command)
+	ctx, cancel := context.WithTimeout(context.Background(), passwordCommandTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, fields[0], fields[1:]...)
+	cmd.Stderr = ioutil.Discard
+	output, err := cmd.Output()
+	if err != nil {
+		// the output is not part of the error, it may hold the password
+		return "", fmt.Errorf("password command %s failed: %v", fields[0], err)
+	}
+	password := strings.TrimSpace(string(output))
+	if password == "" {
+		return "", fmt.Errorf("password command %s printed no password", fields[0])
+	}
+	return password, nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ResolvePassword(t *testing.T) {
+	defer func(a argumentList) { args = a }(args)
+	args = argumentList{Password: " secret "}
+	password, err := resolvePassword()
+	assert.Nil(t, err)
+	assert.Equal(t, "secret", password)
+
+	args = argumentList{PasswordEnv: "COUCHBASE_PLUGIN_TEST_PASSWORD"}
+	_, err = resolvePassword()
+	assert.EqualError(t, err, "password environment variable COUCHBASE_PLUGIN_TEST_PASSWORD is not set")
+	os.Setenv("COUCHBASE_PLUGIN_TEST_PASSWORD", "from-env\n")
+	defer os.Unsetenv("COUCHBASE_PLUGIN_TEST_PASSWORD")
+	password, err = resolvePassword()
+	assert.Nil(t, err)
+	assert.Equal(t, "from-env", password)
+
+	args = argumentList{PasswordCommand: "echo from-command"}
+	password, err = resolvePassword()
+	assert.Nil(t, err)
+	assert.Equal(t, "from-command", password)
+
+	args = argumentList{PasswordCommand: "false"}
+	_, err = resolvePassword()
+	assert.NotNil(t, err)
+	args = argumentList{PasswordCommand: "true"}
+	_, err = resolvePassword()
+	assert.EqualError(t, err, "password command true printed no password")
+
+	args = argumentList{Password: "secret", PasswordEnv: "COUCHBASE_PLUGIN_TEST_PASSWORD"}
+	_, err = resolvePassword()
+	assert.NotNil(t, err)
+}
+
+func Test_ReadPasswordFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "couchbase-plugin-credentials")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "password")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("from-file\n"), 0600))
+
+	password, err := readPasswordFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "from-file", password)
+
+	assert.Nil(t, os.Chmod(path, 0644))
+	_, err = readPasswordFile(path)
+	assert.EqualError(t, err, "password file "+path+" is accessible by other users, its mode must be 0600 or 0400, got 0644")
+
+	_, err = readPasswordFile(dir)
+	assert.NotNil(t, err)
+	_, err = readPasswordFile(filepath.Join(dir, "missing"))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"sync"
+)
+
+const sampleCursorsState = "sample-cursors"
+
+// sampleCursors : timestamp of the newest stats sample aggregated for each bucket and node
+type sampleCursors struct {
+	mu       sync.Mutex
+	previous map[string]float64
+	current  map[string]float64
+}
+
+// loadSampleCursors : cursors that can't be read are reported and the run starts without them
+func loadSampleCursors() (*sampleCursors, error) {
+	c := &sampleCursors{previous: map[string]float64{}, current: map[string]float64{}}
+	if _, err := loadState(sampleCursorsState, &c.previous); err != nil {
+		c.previous = map[string]float64{}
+		return c, err
+	}
+	return c, nil
+}
+
+// save : keeps the cursors advanced on this run and carries over the others, so a bucket or node
+// failing or skipped on this run doesn't lose its cursor
+func (c *sampleCursors) save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cursors := map[string]float64{}
+	for key, ts := range c.previous {
+		cursors[key] = ts
+	}
+	for key, ts := range c.current {
+		cursors[key] = ts
+	}
+	return saveState(sampleCursorsState, cursors)
+}
+
+func (c *sampleCursors) since(bucket string, node string) (float64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ts, ok := c.previous[bucket+"/"+node]
+	return ts, ok
+}
+
+func (c *sampleCursors) advance(bucket string, node string, ts float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.current[bucket+"/"+node] = ts
+}
+
+// newSamples : picks the sample timestamps and the indexes of the samples newer than the cursor,
+// all samples are kept on the first run and none when the cursor is already at the newest sample
+func (c *sampleCursors) newSamples(bucket string, node string, statsData []byte) ([]float64, []int) {
+	var timestamps []float64
+	config := Config{
+		Properties: []Property{
+			{Path: "op/samples/timestamp", Type: "[f]"},
+		},
+	}
+	if err := PickDeserializedUsingConfig(bytes.NewReader(statsData), config, "timestamp", &timestamps); err != nil {
+		return nil, nil
+	}
+	since, found := c.since(bucket, node)
+	indexes := []int{}
+	for i, ts := range timestamps {
+		if !found || ts > since {
+			indexes = append(indexes, i)
+		}
+	}
+	return timestamps, indexes
+}
+
+// selectSamples : the samples at indexes, or all samples when they are not aligned with the timestamps
+func selectSamples(samples []float64, timestamps []float64, indexes []int) []float64 {
+	if indexes == nil || len(samples) != len(timestamps) {
+		return samples
+	}
+	selected := make([]float64, 0, len(indexes))
+	for _, i := range indexes {
+		selected = append(selected, samples[i])
+	}
+	return selected
+}
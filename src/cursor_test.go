@@ -0,0 +1,102 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/newrelic/infra-integrations-sdk/sdk"
+	"github.com/stretchr/testify/assert"
+)
+
+var cursorStatsJSON = `{
+	"op": {
+		"samples": {
+			"timestamp": [1000, 2000, 3000, 4000],
+			"cmd_get": [10, 20, 30, 40],
+			"mem_used": [1, 1, 1, 5]
+		}
+	}
+}`
+
+func Test_SampleCursorsSelectNewSamples(t *testing.T) {
+	c := &sampleCursors{previous: map[string]float64{"travel-sample/10.0.0.1:8091": 2000}, current: map[string]float64{}}
+
+	timestamps, indexes := c.newSamples("travel-sample", "10.0.0.1:8091", []byte(cursorStatsJSON))
+
+	assert.Equal(t, []float64{1000, 2000, 3000, 4000}, timestamps)
+	assert.Equal(t, []int{2, 3}, indexes)
+	assert.Equal(t, []float64{30, 40}, selectSamples([]float64{10, 20, 30, 40}, timestamps, indexes))
+	assert.Equal(t, []float64{1, 2}, selectSamples([]float64{1, 2}, timestamps, indexes))
+}
+
+func Test_SampleCursorsFirstRunAndNothingNewer(t *testing.T) {
+	c := &sampleCursors{previous: map[string]float64{"travel-sample/10.0.0.1:8091": 9000}, current: map[string]float64{}}
+
+	_, first := c.newSamples("beer-sample", "10.0.0.1:8091", []byte(cursorStatsJSON))
+	_, stale := c.newSamples("travel-sample", "10.0.0.1:8091", []byte(cursorStatsJSON))
+	timestamps, missing := c.newSamples("travel-sample", "10.0.0.1:8091", []byte(`{"op": {"samples": {}}}`))
+
+	assert.Equal(t, []int{0, 1, 2, 3}, first)
+	assert.Empty(t, stale)
+	assert.Empty(t, selectSamples([]float64{10, 20, 30, 40}, []float64{1000, 2000, 3000, 4000}, stale))
+	assert.Nil(t, timestamps)
+	assert.Equal(t, []float64{1, 2}, selectSamples([]float64{1, 2}, timestamps, missing))
+}
+
+func Test_PopulateStatsAggregatesSinceLastRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "couchbase-plugin-state")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer func(path string, metrics map[string]metricDef) {
+		args.StatePath, configuredMetrics = path, metrics
+	}(args.StatePath, configuredMetrics)
+	args.StatePath = dir
+	configuredMetrics = map[string]metricDef{"cmd_get": metricDef{metricT: gauge}}
+
+	cursors, err := loadSampleCursors()
+	assert.Nil(t, err)
+	integration := &sdk.Integration{}
+	assert.Nil(t, populateStats(integration, cursors, &counterStore{entries: map[string]counterState{}}, "travel-sample", "10.0.0.1:8091", []byte(cursorStatsJSON)))
+	assert.Equal(t, float64(25), integration.Metrics[0]["cmd_get"])
+	assert.Nil(t, cursors.save())
+
+	cursors, err = loadSampleCursors()
+	assert.Nil(t, err)
+	newer := `{"op": {"samples": {"timestamp": [3000, 4000, 5000, 6000], "cmd_get": [30, 40, 50, 70]}}}`
+	assert.Nil(t, populateStats(integration, cursors, &counterStore{entries: map[string]counterState{}}, "travel-sample", "10.0.0.1:8091", []byte(newer)))
+	assert.Equal(t, float64(60), integration.Metrics[1]["cmd_get"])
+}
+
+func Test_SampleCursorsSaveKeepsCursorsNotAdvanced(t *testing.T) {
+	dir, err := ioutil.TempDir("", "couchbase-plugin-state")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer func(path string) { args.StatePath = path }(args.StatePath)
+	args.StatePath = dir
+
+	cursors, err := loadSampleCursors()
+	assert.Nil(t, err)
+	cursors.advance("travel-sample", "10.0.0.1:8091", 4000)
+	cursors.advance("beer-sample", "10.0.0.1:8091", 2000)
+	assert.Nil(t, cursors.save())
+
+	// beer-sample fails on the next run
+	cursors, err = loadSampleCursors()
+	assert.Nil(t, err)
+	cursors.advance("travel-sample", "10.0.0.1:8091", 6000)
+	assert.Nil(t, cursors.save())
+
+	cursors, err = loadSampleCursors()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]float64{"travel-sample/10.0.0.1:8091": 6000, "beer-sample/10.0.0.1:8091": 2000}, cursors.previous)
+}
+
+func Test_PopulateStatsSkipsBucketWithoutNewSamples(t *testing.T) {
+	cursors := &sampleCursors{previous: map[string]float64{"travel-sample/10.0.0.1:8091": 4000}, current: map[string]float64{}}
+	integration := &sdk.Integration{}
+
+	assert.Nil(t, populateStats(integration, cursors, &counterStore{entries: map[string]counterState{}}, "travel-sample", "10.0.0.1:8091", []byte(cursorStatsJSON)))
+	assert.Empty(t, integration.Metrics)
+	assert.Empty(t, cursors.current)
+}
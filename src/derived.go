@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/newrelic/infra-integrations-sdk/log"
+	"github.com/newrelic/infra-integrations-sdk/metric"
+)
+
+// derivedMetric : a metric computed from other metrics of the same sample
+type derivedMetric struct {
+	name       string
+	expression string
+	compiled   expr
+}
+
+var defaultDerivedMetrics = []derivedMetric{
+	mustDerivedMetric("percent_quota_utilization", "100 * mem_used / ep_mem_high_wat"),
+	mustDerivedMetric("percent_metadata_utilization", "100 * ep_meta_data_memory / ep_mem_high_wat"),
+	mustDerivedMetric("disk_write_queue", "ep_queue_size + ep_flusher_todo"),
+	mustDerivedMetric("total_ops", "cmd_get + cmd_set + incr_misses + incr_hits + decr_misses + decr_hits + delete_misses + delete_hits"),
+}
+
+var configuredDerivedMetrics = defaultDerivedMetrics
+
+func newDerivedMetric(name string, expression string) (derivedMetric, error) {
+	compiled, err := parseExpression(expression)
+	if err != nil {
+		return derivedMetric{}, fmt.Errorf("derived metric '%s': %v", name, err)
+	}
+	return derivedMetric{name: name, expression: expression, compiled: compiled}, nil
+}
+
+func mustDerivedMetric(name string, expression string) derivedMetric {
+	d, err := newDerivedMetric(name, expression)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// setDerivedMetrics : sets every derived metric whose inputs are in values, derived metrics may use the ones defined before them
+func setDerivedMetrics(ms *metric.MetricSet, values map[string]float64, derived []derivedMetric) {
+	for _, d := range derived {
+		v, err := d.compiled.eval(values)
+		if err != nil {
+			log.Debug("Skipping derived metric %s: %v", d.name, err)
+			continue
+		}
+		values[d.name] = v
+		ms.SetMetric(d.name, v, metric.GAUGE)
+	}
+}
+
+type expr interface {
+	eval(values map[string]float64) (float64, error)
+	variables() []string
+}
+
+type numberExpr float64
+
+type variableExpr string
+
+type negateExpr struct {
+	operand expr
+}
+
+type binaryExpr struct {
+	op          byte
+	left, right expr
+}
+
+func (e numberExpr) eval(values map[string]float64) (float64, error) {
+	return float64(e), nil
+}
+
+func (e numberExpr) variables() []string {
+	return nil
+}
+
+func (e variableExpr) eval(values map[string]float64) (float64, error) {
+	v, ok := values[string(e)]
+	if !ok {
+		return 0, fmt.Errorf("metric '%s' was not collected", string(e))
+	}
+	return v, nil
+}
+
+func (e variableExpr) variables() []string {
+	return []string{string(e)}
+}
+
+func (e negateExpr) eval(values map[string]float64) (float64, error) {
+	v, err := e.operand.eval(values)
+	return -v, err
+}
+
+func (e negateExpr) variables() []string {
+	return e.operand.variables()
+}
+
+func (e binaryExpr) eval(values map[string]float64) (float64, error) {
+	l, err := e.left.eval(values)
+	if err != nil {
+		return 0, err
+	}
+	r, err := e.right.eval(values)
+	if err != nil {
+		return 0, err
+	}
+	var v float64
+	switch e.op {
+	case '+':
+		v = l + r
+	case '-':
+		v = l - r
+	case '*':
+		v = l * r
+	case '/':
+		if r == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		v = l / r
+	}
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("result is not a finite number")
+	}
+	return v, nil
+}
+
+func (e binaryExpr) variables() []string {
+	return append(e.left.variables(), e.right.variables()...)
+}
+
+// expressionParser : recursive descent parser for + - * / expressions over numbers and metric names
+type expressionParser struct {
+	tokens []string
+	pos    int
+}
+
+func parseExpression(s string) (expr, error) {
+	tokens, err := tokenizeExpression(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty expression")
+	}
+	p := &expressionParser{tokens: tokens}
+	e, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected '%s'", p.tokens[p.pos])
+	}
+	return e, nil
+}
+
+func tokenizeExpression(s string) ([]string, error) {
+	tokens := []string{}
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case strings.IndexByte("+-*/()", c) >= 0:
+			tokens = append(tokens, string(c))
+			i++
+		case isNameChar(c) || c == '.':
+			start := i
+			for i < len(s) && (isNameChar(s[i]) || s[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, s[start:i])
+		default:
+			return nil, fmt.Errorf("unexpected character '%c'", c)
+		}
+	}
+	return tokens, nil
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func (p *expressionParser) next() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *expressionParser) parseSum() (expr, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for p.next() == "+" || p.next() == "-" {
+		op := p.next()[0]
+		p.pos++
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *expressionParser) parseProduct() (expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.next() == "*" || p.next() == "/" {
+		op := p.next()[0]
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *expressionParser) parseUnary() (expr, error) {
+	token := p.next()
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case token == "-":
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return negateExpr{operand: operand}, nil
+	case token == "(":
+		p.pos++
+		e, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing ')'")
+		}
+		p.pos++
+		return e, nil
+	case (token[0] >= '0' && token[0] <= '9') || token[0] == '.':
+		p.pos++
+		v, err := strconv.ParseFloat(token, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number '%s'", token)
+		}
+		return numberExpr(v), nil
+	case isNameChar(token[0]):
+		p.pos++
+		return variableExpr(token), nil
+	}
+	return nil, fmt.Errorf("unexpected '%s'", token)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/newrelic/infra-integrations-sdk/metric"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseAndEvalExpression(t *testing.T) {
+	values := map[string]float64{"a": 6, "b": 3, "c.d": 2, "zero": 0}
+	var tests = []struct {
+		expression string
+		expected   float64
+	}{
+		{"a + b", 9},
+		{"a - b - 1", 2},
+		{"a / b / c.d", 1},
+		{"a + b * c.d", 12},
+		{"(a + b) * c.d", 18},
+		{"-a + 10", 4},
+		{"100 * b / a", 50},
+		{"2.5 * c.d", 5},
+	}
+	for _, tt := range tests {
+		e, err := parseExpression(tt.expression)
+		assert.Nil(t, err, tt.expression)
+
+		v, err := e.eval(values)
+
+		assert.Nil(t, err, tt.expression)
+		assert.Equal(t, tt.expected, v, tt.expression)
+	}
+}
+
+func Test_EvalExpressionErrors(t *testing.T) {
+	values := map[string]float64{"a": 6, "zero": 0}
+	for _, expression := range []string{"a / zero", "a / (a - 6)", "a + missing"} {
+		e, err := parseExpression(expression)
+		assert.Nil(t, err, expression)
+
+		_, err = e.eval(values)
+
+		assert.NotNil(t, err, expression)
+	}
+}
+
+func Test_ParseExpressionErrors(t *testing.T) {
+	for _, expression := range []string{"", "a +", "(a + b", "a b", "a % b", "1.2.3"} {
+		_, err := parseExpression(expression)
+
+		assert.NotNil(t, err, expression)
+	}
+}
+
+func Test_SetDerivedMetrics(t *testing.T) {
+	ms := metric.NewMetricSet("CouchbaseSample")
+	values := map[string]float64{
+		"mem_used":            50,
+		"ep_mem_high_wat":     200,
+		"ep_meta_data_memory": 10,
+		"ep_queue_size":       3,
+		"ep_flusher_todo":     4,
+		"cmd_get":             1,
+	}
+
+	setDerivedMetrics(&ms, values, defaultDerivedMetrics)
+
+	assert.Equal(t, float64(25), ms["percent_quota_utilization"])
+	assert.Equal(t, float64(5), ms["percent_metadata_utilization"])
+	assert.Equal(t, float64(7), ms["disk_write_queue"])
+	assert.NotContains(t, ms, "total_ops")
+
+	values["ep_mem_high_wat"] = 0
+	ms = metric.NewMetricSet("CouchbaseSample")
+	setDerivedMetrics(&ms, values, defaultDerivedMetrics)
+	assert.NotContains(t, ms, "percent_quota_utilization")
+}
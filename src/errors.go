@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/newrelic/infra-integrations-sdk/log"
+	"github.com/newrelic/infra-integrations-sdk/metric"
+	"github.com/newrelic/infra-integrations-sdk/sdk"
+)
+
+// collectionError : a collection step that failed, reported as CouchbaseCollectionErrorSample
+type collectionError struct {
+	endpoint string
+	bucket   string
+	node     string
+	cause    error
+}
+
+func (e *collectionError) Error() string {
+	where := []string{}
+	if e.endpoint != "" {
+		where = append(where, "endpoint "+e.endpoint)
+	}
+	if e.bucket != "" {
+		where = append(where, "bucket "+e.bucket)
+	}
+	if e.node != "" {
+		where = append(where, "node "+e.node)
+	}
+	if len(where) == 0 {
+		return e.cause.Error()
+	}
+	return fmt.Sprintf("collecting %s: %v", strings.Join(where, ", "), e.cause)
+}
+
+// collectionErrors : failures of a step that keeps collecting after an error
+type collectionErrors []error
+
+func (errs collectionErrors) Error() string {
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+// collectionFailure : names the endpoint, bucket and node err was collected from. Errors that already name them are kept.
+func collectionFailure(endpoint string, bucket string, node string, err error) error {
+	switch err.(type) {
+	case nil:
+		return nil
+	case *collectionError, collectionErrors:
+		return err
+	}
+	return &collectionError{endpoint: endpoint, bucket: bucket, node: node, cause: err}
+}
+
+// flattenErrors : expands collectionErrors into the failures they hold
+func flattenErrors(errs []error) []error {
+	flat := []error{}
+	for _, err := range errs {
+		if list, ok := err.(collectionErrors); ok {
+			flat = append(flat, flattenErrors(list)...)
+		} else if err != nil {
+			flat = append(flat, err)
+		}
+	}
+	return flat
+}
+
+func setCollectionErrors(integration *sdk.Integration, errs []error) {
+	for _, err := range flattenErrors(errs) {
+		log.Error("%s", err)
+		failure, ok := err.(*collectionError)
+		if !ok {
+			failure = &collectionError{cause: err}
+		}
+		ms := newMetricSet(integration, "CouchbaseCollectionErrorSample")
+		ms.SetMetric("endpoint", failure.endpoint, metric.ATTRIBUTE)
+		ms.SetMetric("bucket", failure.bucket, metric.ATTRIBUTE)
+		ms.SetMetric("node", failure.node, metric.ATTRIBUTE)
+		ms.SetMetric("cause", failure.cause.Error(), metric.ATTRIBUTE)
+		if e, ok := failure.cause.(*restError); ok {
+			ms.SetMetric("errorType", e.kind.String(), metric.ATTRIBUTE)
+			ms.SetMetric("status", e.status, metric.GAUGE)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/newrelic/infra-integrations-sdk/sdk"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_CollectionFailure(t *testing.T) {
+	assert.Nil(t, collectionFailure("/pools/default", "", "", nil))
+
+	err := collectionFailure("/pools/default/buckets/beer/stats", "beer", "10.0.0.1:8091", errors.New("connection refused"))
+	assert.EqualError(t, err, "collecting endpoint /pools/default/buckets/beer/stats, bucket beer, node 10.0.0.1:8091: connection refused")
+	assert.Equal(t, err, collectionFailure("/pools/default", "", "", err))
+
+	list := collectionErrors{err}
+	assert.Equal(t, list, collectionFailure("/pools/default", "", "", list))
+}
+
+func Test_SetCollectionErrors(t *testing.T) {
+	integration := &sdk.Integration{}
+	setCollectionErrors(integration, []error{
+		collectionErrors{
+			collectionFailure("/pools/default/buckets/beer/stats", "beer", "10.0.0.1:8091", errors.New("missing stats ep_dcp_2i_items_remaining")),
+			collectionFailure("http://10.0.0.2:8093/admin/vitals", "", "10.0.0.2:8091", errors.New("timeout")),
+		},
+		errors.New("no such file"),
+	})
+
+	assert.Len(t, integration.Metrics, 3)
+	first := integration.Metrics[0]
+	assert.Equal(t, "CouchbaseCollectionErrorSample", first["event_type"])
+	assert.Equal(t, "/pools/default/buckets/beer/stats", first["endpoint"])
+	assert.Equal(t, "beer", first["bucket"])
+	assert.Equal(t, "10.0.0.1:8091", first["node"])
+	assert.Equal(t, "missing stats ep_dcp_2i_items_remaining", first["cause"])
+	assert.Equal(t, "10.0.0.2:8091", integration.Metrics[1]["node"])
+	assert.Equal(t, "", integration.Metrics[2]["endpoint"])
+	assert.Equal(t, "no such file", integration.Metrics[2]["cause"])
+}
+
+func Test_PopulateStatsSkipsMissingStats(t *testing.T) {
+	defer func(metrics map[string]metricDef) { configuredMetrics = metrics }(configuredMetrics)
+	configuredMetrics = map[string]metricDef{
+		"cmd_get":                   metricDef{metricT: gauge},
+		"ep_dcp_2i_items_remaining": metricDef{metricT: gauge},
+	}
+	cursors := &sampleCursors{previous: map[string]float64{}, current: map[string]float64{}}
+	statsData := `{"op": {"samples": {"timestamp": [1000, 2000], "cmd_get": [10, 30]}}}`
+
+	integration := &sdk.Integration{}
+	err := populateStats(integration, cursors, &counterStore{entries: map[string]counterState{}}, "memcached", "10.0.0.1:8091", []byte(statsData))
+	assert.EqualError(t, err, "missing stats ep_dcp_2i_items_remaining")
+	assert.Equal(t, float64(20), integration.Metrics[0]["cmd_get"])
+}
+
+func Test_GetAllStatsEndpointsErrors(t *testing.T) {
+	var endpoints []statsEndpoint
+	assert.NotNil(t, getAllStatsEndpoints([]byte(`{"servers": [{"hostname": "10.0.0.1:8091"}]}`), "beer", &endpoints))
+	assert.Empty(t, endpoints)
+
+	names, err := getAllBucketNames([]byte(`not json`))
+	assert.NotNil(t, err)
+	assert.Empty(t, names)
+}
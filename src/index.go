@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/newrelic/infra-integrations-sdk/log"
+	"github.com/newrelic/infra-integrations-sdk/metric"
+	"github.com/newrelic/infra-integrations-sdk/sdk"
+)
+
+const (
+	indexPort    = 9102
+	indexSSLPort = 19102
+)
+
+var indexMetrics = map[string]metricDef{
+	"items_count":         metricDef{metricT: gauge},
+	"num_docs_pending":    metricDef{metricT: gauge},
+	"num_docs_queued":     metricDef{metricT: gauge},
+	"num_docs_indexed":    metricDef{metricT: gauge},
+	"disk_size":           metricDef{metricT: gauge},
+	"data_size":           metricDef{metricT: gauge},
+	"memory_used":         metricDef{metricT: gauge},
+	"resident_percent":    metricDef{metricT: gauge},
+	"frag_percent":        metricDef{metricT: gauge},
+	"avg_scan_latency":    metricDef{metricT: gauge},
+	"avg_item_size":       metricDef{metricT: gauge},
+	"num_requests":        metricDef{metricT: gauge},
+	"num_rows_returned":   metricDef{metricT: gauge},
+	"build_progress":      metricDef{metricT: gauge},
+	"cache_hit_percent":   metricDef{metricT: gauge},
+	"scan_bytes_read":     metricDef{metricT: gauge},
+	"total_scan_duration": metricDef{metricT: gauge},
+	"num_scan_errors":     metricDef{metricT: gauge},
+	"num_scan_timeouts":   metricDef{metricT: gauge},
+}
+
+type indexKey struct {
+	bucket     string
+	scope      string
+	collection string
+	index      string
+}
+
+func populateIndexStats(ctx context.Context, integration *sdk.Integration, node nodeInfo) error {
+	indexURL := serviceURL(node.Hostname, indexPort, indexSSLPort)
+	log.Debug("Processing index metrics at %s", indexURL)
+	statsData, err := httpGetURL(ctx, indexURL+"/stats")
+	if err == nil {
+		err = setIndexStats(integration, node.Hostname, statsData, strings.TrimSpace(args.Bucket))
+	}
+	return collectionFailure(indexURL+"/stats", "", node.Hostname, err)
+}
+
+func setIndexStats(integration *sdk.Integration, hostname string, statsData []byte, bucketArg string) error {
+	indexes, _, err := groupIndexStats(statsData, bucketArg, indexMetrics)
+	if err != nil {
+		return err
+	}
+	for _, idx := range sortedIndexKeys(indexes) {
+		ms := newMetricSet(integration, "CouchbaseIndexSample")
+		setIndexAttributes(ms, idx, hostname)
+		for statName, v := range indexes[idx] {
+			ms.SetMetric(statName, v, sourceType(indexMetrics[statName].metricT))
+		}
+	}
+	return nil
+}
+
+// groupIndexStats : groups flat bucket:index:stat keys by index, keys without an index are returned as node stats
+func groupIndexStats(statsData []byte, bucketArg string, metrics map[string]metricDef) (map[indexKey]map[string]float64, map[string]float64, error) {
+	var stats map[string]interface{}
+	if err := json.Unmarshal(statsData, &stats); err != nil {
+		return nil, nil, err
+	}
+
+	indexes := map[indexKey]map[string]float64{}
+	nodeStats := map[string]float64{}
+	for key, value := range stats {
+		v, ok := value.(float64)
+		if !ok {
+			continue
+		}
+		parts := strings.Split(key, ":")
+		var idx indexKey
+		switch len(parts) {
+		case 1:
+			nodeStats[key] = v
+			continue
+		case 3:
+			idx = indexKey{bucket: parts[0], index: parts[1]}
+		case 5:
+			idx = indexKey{bucket: parts[0], scope: parts[1], collection: parts[2], index: parts[3]}
+		default:
+			continue
+		}
+		if bucketArg != "all" && bucketArg != idx.bucket {
+			continue
+		}
+		statName := parts[len(parts)-1]
+		if _, configured := metrics[statName]; !configured {
+			continue
+		}
+		if _, ok := indexes[idx]; !ok {
+			indexes[idx] = map[string]float64{}
+		}
+		indexes[idx][statName] = v
+	}
+	return indexes, nodeStats, nil
+}
+
+func sortedIndexKeys(indexes map[indexKey]map[string]float64) []indexKey {
+	keys := make([]indexKey, 0, len(indexes))
+	for idx := range indexes {
+		keys = append(keys, idx)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+	return keys
+}
+
+func (idx indexKey) String() string {
+	return strings.Join([]string{idx.bucket, idx.scope, idx.collection, idx.index}, ":")
+}
+
+func setIndexAttributes(ms *metric.MetricSet, idx indexKey, hostname string) {
+	ms.SetMetric("bucket", idx.bucket, metric.ATTRIBUTE)
+	ms.SetMetric("index", idx.index, metric.ATTRIBUTE)
+	ms.SetMetric("node", hostname, metric.ATTRIBUTE)
+	if idx.scope != "" {
+		ms.SetMetric("scope", idx.scope, metric.ATTRIBUTE)
+		ms.SetMetric("collection", idx.collection, metric.ATTRIBUTE)
+	}
+}
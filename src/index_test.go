@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/newrelic/infra-integrations-sdk/sdk"
+	"github.com/stretchr/testify/assert"
+)
+
+var indexStatsJSON = `{
+	"memory_quota": 536870912,
+	"num_connections": 4,
+	"travel-sample:def_type:items_count": 31591,
+	"travel-sample:def_type:num_docs_pending": 2,
+	"travel-sample:def_type:frag_percent": 12,
+	"travel-sample:def_type:avg_scan_latency": 450000,
+	"travel-sample:def_type:index_state": "ready",
+	"travel-sample:def_city:items_count": 120,
+	"sessions:_default:users:by_email:resident_percent": 100,
+	"beer-sample:beer_primary:items_count": 7303
+}`
+
+func Test_SetIndexStats(t *testing.T) {
+	integration := &sdk.Integration{}
+
+	err := setIndexStats(integration, "10.0.0.1:8091", []byte(indexStatsJSON), "all")
+
+	assert.Nil(t, err)
+	assert.Len(t, integration.Metrics, 4)
+
+	byEmail := integration.Metrics[1]
+	assert.Equal(t, "CouchbaseIndexSample", byEmail["event_type"])
+	assert.Equal(t, "sessions", byEmail["bucket"])
+	assert.Equal(t, "by_email", byEmail["index"])
+	assert.Equal(t, "users", byEmail["collection"])
+	assert.Equal(t, float64(100), byEmail["resident_percent"])
+
+	defType := integration.Metrics[3]
+	assert.Equal(t, "travel-sample", defType["bucket"])
+	assert.Equal(t, "def_type", defType["index"])
+	assert.Equal(t, "10.0.0.1:8091", defType["node"])
+	assert.Equal(t, float64(31591), defType["items_count"])
+	assert.Equal(t, float64(2), defType["num_docs_pending"])
+	assert.Equal(t, float64(450000), defType["avg_scan_latency"])
+	assert.NotContains(t, defType, "index_state")
+	assert.NotContains(t, defType, "scope")
+}
+
+func Test_SetIndexStatsFiltersBucket(t *testing.T) {
+	integration := &sdk.Integration{}
+
+	err := setIndexStats(integration, "10.0.0.1:8091", []byte(indexStatsJSON), "beer-sample")
+
+	assert.Nil(t, err)
+	assert.Len(t, integration.Metrics, 1)
+	assert.Equal(t, "beer_primary", integration.Metrics[0]["index"])
+}
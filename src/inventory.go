@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/newrelic/infra-integrations-sdk/sdk"
+)
+
+type clusterInfo struct {
+	ImplementationVersion string
+	UUID                  string
+}
+
+type nodeInfo struct {
+	Hostname           string
+	Version            string
+	Services           []string
+	ClusterMembership  string
+	AlternateAddresses struct{ External alternateAddress }
+}
+
+type defaultPoolInfo struct {
+	ClusterName string
+	Nodes       []nodeInfo
+}
+
+type bucketInfo struct {
+	Name                   string
+	BucketType             string
+	Quota                  struct{ RAM float64 }
+	ReplicaNumber          int
+	EvictionPolicy         string
+	ConflictResolutionType string
+	AutoCompactionSettings json.RawMessage
+}
+
+// populateInventory : the cluster and the bucket inventories are collected independently, the failed ones are returned
+func populateInventory(ctx context.Context, inventory sdk.Inventory) []error {
+	var errs []error
+	poolsData, err := httpGet(ctx, "/pools")
+	if err != nil {
+		errs = append(errs, collectionFailure("/pools", "", "", err))
+	}
+	defaultPoolData, err := httpGet(ctx, "/pools/default")
+	if err != nil {
+		errs = append(errs, collectionFailure("/pools/default", "", "", err))
+	}
+	if poolsData != nil && defaultPoolData != nil {
+		if err := setClusterInventory(inventory, poolsData, defaultPoolData); err != nil {
+			errs = append(errs, collectionFailure("/pools/default", "", "", err))
+		}
+	}
+
+	bucketsData, err := httpGet(ctx, "/pools/default/buckets")
+	if err == nil {
+		err = setBucketInventory(inventory, bucketsData, strings.TrimSpace(args.Bucket))
+	}
+	if err != nil {
+		errs = append(errs, collectionFailure("/pools/default/buckets", "", "", err))
+	}
+	setMetricInventory(inventory, configuredMetrics)
+	return errs
+}
+
+func getClusterInfo(data []byte) (clusterInfo, error) {
+	var info clusterInfo
+	config := Config{
+		Properties: []Property{
+			{Path: "implementationVersion", Type: "s"},
+			{Path: "uuid", Type: "s"},
+		},
+	}
+	err := PickDeserializedUsingConfig(bytes.NewReader(data), config, "", &info)
+	return info, err
+}
+
+func getDefaultPoolInfo(data []byte) (defaultPoolInfo, error) {
+	var info defaultPoolInfo
+	config := Config{
+		Properties: []Property{
+			{Path: "clusterName", Type: "s"},
+			{Path: "nodes", Type: "[o]"},
+		},
+	}
+	err := PickDeserializedUsingConfig(bytes.NewReader(data), config, "", &info)
+	return info, err
+}
+
+func getBucketInfos(data []byte) ([]bucketInfo, error) {
+	var buckets []bucketInfo
+	bucketsAlias := "buckets"
+	config := Config{
+		Properties: []Property{
+			{Path: ".", Type: "[o]", Alias: &bucketsAlias},
+		},
+	}
+	err := PickDeserializedUsingConfig(bytes.NewReader(data), config, bucketsAlias, &buckets)
+	return buckets, err
+}
+
+func setClusterInventory(inventory sdk.Inventory, poolsData []byte, defaultPoolData []byte) error {
+	cluster, err := getClusterInfo(poolsData)
+	if err != nil {
+		return err
+	}
+	pool, err := getDefaultPoolInfo(defaultPoolData)
+	if err != nil {
+		return err
+	}
+
+	inventory.SetItem("cluster", "version", cluster.ImplementationVersion)
+	inventory.SetItem("cluster", "uuid", cluster.UUID)
+	inventory.SetItem("cluster", "name", pool.ClusterName)
+	for _, node := range pool.Nodes {
+		key := "node/" + node.Hostname
+		services := append([]string{}, node.Services...)
+		sort.Strings(services)
+		inventory.SetItem(key, "version", node.Version)
+		inventory.SetItem(key, "services", strings.Join(services, ","))
+		inventory.SetItem(key, "clusterMembership", node.ClusterMembership)
+	}
+	return nil
+}
+
+func setBucketInventory(inventory sdk.Inventory, bucketsData []byte, bucketArg string) error {
+	buckets, err := getBucketInfos(bucketsData)
+	if err != nil {
+		return err
+	}
+	for _, bucket := range buckets {
+		if bucketArg != "all" && bucketArg != bucket.Name {
+			continue
+		}
+		key := "bucket/" + bucket.Name
+		inventory.SetItem(key, "bucketType", bucket.BucketType)
+		inventory.SetItem(key, "ramQuota", bucket.Quota.RAM)
+		inventory.SetItem(key, "replicaNumber", bucket.ReplicaNumber)
+		inventory.SetItem(key, "evictionPolicy", bucket.EvictionPolicy)
+		inventory.SetItem(key, "conflictResolutionType", bucket.ConflictResolutionType)
+
+		// autoCompactionSettings is false when the bucket uses the cluster wide settings
+		var compaction interface{}
+		if len(bucket.AutoCompactionSettings) > 0 {
+			if err := json.Unmarshal(bucket.AutoCompactionSettings, &compaction); err != nil {
+				return err
+			}
+		}
+		settings, ok := compaction.(map[string]interface{})
+		if !ok {
+			inventory.SetItem(key, "compaction", "cluster")
+			continue
+		}
+		inventory.SetItem(key, "compaction", "bucket")
+		setFlattenedItems(inventory, key, "compaction.", settings)
+	}
+	return nil
+}
+
+func setFlattenedItems(inventory sdk.Inventory, key string, prefix string, values map[string]interface{}) {
+	for name, value := range values {
+		if nested, ok := value.(map[string]interface{}); ok {
+			setFlattenedItems(inventory, key, prefix+name+".", nested)
+			continue
+		}
+		if _, ok := value.([]interface{}); ok {
+			value = fmt.Sprint(value)
+		}
+		inventory.SetItem(key, prefix+name, value)
+	}
+}
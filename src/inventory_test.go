@@ -0,0 +1,97 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/newrelic/infra-integrations-sdk/sdk"
+	"github.com/stretchr/testify/assert"
+)
+
+var poolsJSON = `{
+	"isAdminCreds": true,
+	"implementationVersion": "5.0.1-5003-enterprise",
+	"uuid": "9b5a2d4b6e7e4a0d8f1c",
+	"pools": [{"name": "default", "uri": "/pools/default"}]
+}`
+
+var defaultPoolJSON = `{
+	"name": "default",
+	"clusterName": "prod-east",
+	"nodes": [
+		{
+			"hostname": "10.0.0.1:8091",
+			"version": "5.0.1-5003-enterprise",
+			"services": ["n1ql", "kv"],
+			"clusterMembership": "active"
+		},
+		{
+			"hostname": "10.0.0.2:8091",
+			"version": "5.0.1-5003-enterprise",
+			"services": ["index"],
+			"clusterMembership": "inactiveFailed"
+		}
+	]
+}`
+
+var bucketsJSON = `[
+	{
+		"name": "travel-sample",
+		"bucketType": "membase",
+		"quota": {"ram": 104857600, "rawRAM": 104857600},
+		"replicaNumber": 1,
+		"evictionPolicy": "valueOnly",
+		"conflictResolutionType": "seqno",
+		"autoCompactionSettings": false
+	},
+	{
+		"name": "sessions",
+		"bucketType": "ephemeral",
+		"quota": {"ram": 52428800, "rawRAM": 52428800},
+		"replicaNumber": 0,
+		"evictionPolicy": "noEviction",
+		"conflictResolutionType": "lww",
+		"autoCompactionSettings": {
+			"parallelDBAndViewCompaction": false,
+			"databaseFragmentationThreshold": {"percentage": 30, "size": "undefined"}
+		}
+	}
+]`
+
+func Test_SetClusterInventory(t *testing.T) {
+	inventory := sdk.Inventory{}
+
+	err := setClusterInventory(inventory, []byte(poolsJSON), []byte(defaultPoolJSON))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "5.0.1-5003-enterprise", inventory["cluster"]["version"])
+	assert.Equal(t, "9b5a2d4b6e7e4a0d8f1c", inventory["cluster"]["uuid"])
+	assert.Equal(t, "prod-east", inventory["cluster"]["name"])
+	assert.Equal(t, "kv,n1ql", inventory["node/10.0.0.1:8091"]["services"])
+	assert.Equal(t, "inactiveFailed", inventory["node/10.0.0.2:8091"]["clusterMembership"])
+}
+
+func Test_SetBucketInventory(t *testing.T) {
+	inventory := sdk.Inventory{}
+
+	err := setBucketInventory(inventory, []byte(bucketsJSON), "all")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "membase", inventory["bucket/travel-sample"]["bucketType"])
+	assert.Equal(t, float64(104857600), inventory["bucket/travel-sample"]["ramQuota"])
+	assert.Equal(t, 1, inventory["bucket/travel-sample"]["replicaNumber"])
+	assert.Equal(t, "cluster", inventory["bucket/travel-sample"]["compaction"])
+	assert.Equal(t, "lww", inventory["bucket/sessions"]["conflictResolutionType"])
+	assert.Equal(t, "bucket", inventory["bucket/sessions"]["compaction"])
+	assert.Equal(t, float64(30), inventory["bucket/sessions"]["compaction.databaseFragmentationThreshold.percentage"])
+	assert.Equal(t, false, inventory["bucket/sessions"]["compaction.parallelDBAndViewCompaction"])
+}
+
+func Test_SetBucketInventoryFiltersBucket(t *testing.T) {
+	inventory := sdk.Inventory{}
+
+	err := setBucketInventory(inventory, []byte(bucketsJSON), "sessions")
+
+	assert.Nil(t, err)
+	assert.Contains(t, inventory, "bucket/sessions")
+	assert.NotContains(t, inventory, "bucket/travel-sample")
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/newrelic/infra-integrations-sdk/metric"
+	"github.com/newrelic/infra-integrations-sdk/sdk"
+)
+
+var nodeMetrics = map[string]pickedMetric{
+	"hostname":                         pickedMetric{"hostname", "s", attribute},
+	"version":                          pickedMetric{"version", "s", attribute},
+	"status":                           pickedMetric{"status", "s", attribute},
+	"clusterMembership":                pickedMetric{"clusterMembership", "s", attribute},
+	"systemStats.cpu_utilization_rate": pickedMetric{"systemStats/cpu_utilization_rate", "f", gauge},
+	"systemStats.swap_total":           pickedMetric{"systemStats/swap_total", "f", gauge},
+	"systemStats.swap_used":            pickedMetric{"systemStats/swap_used", "f", gauge},
+	"systemStats.mem_total":            pickedMetric{"systemStats/mem_total", "f", gauge},
+	"systemStats.mem_free":             pickedMetric{"systemStats/mem_free", "f", gauge},
+	"memoryTotal":                      pickedMetric{"memoryTotal", "f", gauge},
+	"memoryFree":                       pickedMetric{"memoryFree", "f", gauge},
+	"mcdMemoryReserved":                pickedMetric{"mcdMemoryReserved", "f", gauge},
+	"mcdMemoryAllocated":               pickedMetric{"mcdMemoryAllocated", "f", gauge},
+}
+
+func populateNodeStats(integration *sdk.Integration, poolData []byte, nodeArg string) error {
+	var nodes []map[string]interface{}
+	config := Config{
+		Properties: []Property{
+			{Path: "nodes", Type: "[o]"},
+		},
+	}
+	err := PickDeserializedUsingConfig(bytes.NewReader(poolData), config, "nodes", &nodes)
+	if err != nil {
+		return err
+	}
+
+	for _, node := range nodes {
+		hostname, _ := node["hostname"].(string)
+		if nodeArg != "all" && nodeArg != hostname {
+			continue
+		}
+		nodeData, err := json.Marshal(node)
+		if err != nil {
+			return err
+		}
+
+		ms := newMetricSet(integration, "CouchbaseNodeSample")
+		setPickedMetrics(ms, nodeData, nodeMetrics)
+		ms.SetMetric("services", joinServices(node["services"]), metric.ATTRIBUTE)
+
+		// uptime is reported as a string of seconds
+		if uptime, ok := node["uptime"].(string); ok {
+			if seconds, err := strconv.ParseFloat(uptime, 64); err == nil {
+				ms.SetMetric("uptime", seconds, metric.GAUGE)
+			}
+		}
+		if stats, ok := node["interestingStats"].(map[string]interface{}); ok {
+			for name, value := range stats {
+				if v, ok := value.(float64); ok {
+					ms.SetMetric("interestingStats."+name, v, metric.GAUGE)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// scheduleServiceStats : schedules the collectors of the non data services running on each node
+func scheduleServiceStats(ctx context.Context, pool *workerPool, integration *sdk.Integration, poolData []byte) error {
+	info, err := getDefaultPoolInfo(poolData)
+	if err != nil {
+		return err
+	}
+	nodeArg := strings.TrimSpace(args.Node)
+	for _, node := range info.Nodes {
+		if nodeArg != "all" && nodeArg != node.Hostname {
+			continue
+		}
+		node := node
+		for _, service := range node.Services {
+			switch service {
+			case "n1ql":
+				pool.Go(node.Hostname, func() error {
+					return populateQueryStats(ctx, integration, node)
+				})
+			case "index":
+				pool.Go(node.Hostname, func() error {
+					return populateIndexStats(ctx, integration, node)
+				})
+			case "fts":
+				pool.Go(node.Hostname, func() error {
+					return populateSearchStats(ctx, integration, node)
+				})
+			}
+		}
+	}
+	return nil
+}
+
+func joinServices(value interface{}) string {
+	list, _ := value.([]interface{})
+	services := []string{}
+	for _, s := range list {
+		if service, ok := s.(string); ok {
+			services = append(services, service)
+		}
+	}
+	sort.Strings(services)
+	return strings.Join(services, ",")
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/newrelic/infra-integrations-sdk/sdk"
+	"github.com/stretchr/testify/assert"
+)
+
+var nodesPoolJSON = `{
+	"name": "default",
+	"nodes": [
+		{
+			"hostname": "10.0.0.1:8091",
+			"version": "5.0.1-5003-enterprise",
+			"services": ["n1ql", "kv"],
+			"status": "healthy",
+			"clusterMembership": "active",
+			"uptime": "3600",
+			"memoryTotal": 8000,
+			"systemStats": {"cpu_utilization_rate": 12.5, "swap_total": 100, "swap_used": 10, "mem_total": 8000, "mem_free": 2000},
+			"interestingStats": {"curr_items": 42, "ops": 7}
+		},
+		{
+			"hostname": "10.0.0.2:8091",
+			"version": "5.0.1-5003-enterprise",
+			"services": ["index"],
+			"status": "unhealthy",
+			"clusterMembership": "active",
+			"uptime": "60"
+		}
+	]
+}`
+
+func Test_PopulateNodeStats(t *testing.T) {
+	integration := &sdk.Integration{}
+
+	err := populateNodeStats(integration, []byte(nodesPoolJSON), "all")
+
+	assert.Nil(t, err)
+	assert.Len(t, integration.Metrics, 2)
+	ms := integration.Metrics[0]
+	assert.Equal(t, "CouchbaseNodeSample", ms["event_type"])
+	assert.Equal(t, "10.0.0.1:8091", ms["hostname"])
+	assert.Equal(t, "kv,n1ql", ms["services"])
+	assert.Equal(t, "healthy", ms["status"])
+	assert.Equal(t, float64(3600), ms["uptime"])
+	assert.Equal(t, 12.5, ms["systemStats.cpu_utilization_rate"])
+	assert.Equal(t, float64(2000), ms["systemStats.mem_free"])
+	assert.Equal(t, float64(42), ms["interestingStats.curr_items"])
+	assert.Equal(t, "unhealthy", integration.Metrics[1]["status"])
+}
+
+func Test_PopulateNodeStatsFiltersNode(t *testing.T) {
+	integration := &sdk.Integration{}
+
+	err := populateNodeStats(integration, []byte(nodesPoolJSON), "10.0.0.2:8091")
+
+	assert.Nil(t, err)
+	assert.Len(t, integration.Metrics, 1)
+	assert.Equal(t, "index", integration.Metrics[0]["services"])
+}
+
+func Test_ScheduleServiceStatsFiltersNode(t *testing.T) {
+	defer func(node string) { args.Node = node }(args.Node)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	poolData := []byte(`{"clusterName": "test",` + nodesPoolJSON[1:])
+
+	// the jobs of a cancelled pool are skipped and counted
+	args.Node = "all"
+	pool := newWorkerPool(ctx, 1, 1)
+	assert.Nil(t, scheduleServiceStats(ctx, pool, &sdk.Integration{}, poolData))
+	assert.EqualError(t, pool.Wait()[0], "2 collection steps skipped: context canceled")
+
+	args.Node = "10.0.0.2:8091"
+	pool = newWorkerPool(ctx, 1, 1)
+	assert.Nil(t, scheduleServiceStats(ctx, pool, &sdk.Integration{}, poolData))
+	assert.EqualError(t, pool.Wait()[0], "1 collection steps skipped: context canceled")
+}
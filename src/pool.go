@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// workerPool : runs jobs concurrently, bounded by a global limit and a per node limit.
+// Jobs still waiting for a slot when ctx is done are skipped.
+type workerPool struct {
+	ctx       context.Context
+	global    chan struct{}
+	nodeLimit int
+
+	mu      sync.Mutex
+	nodes   map[string]chan struct{}
+	errs    []error
+	skipped int
+
+	wg sync.WaitGroup
+}
+
+func newWorkerPool(ctx context.Context, limit int, nodeLimit int) *workerPool {
+	if limit < 1 {
+		limit = 1
+	}
+	if nodeLimit < 1 || nodeLimit > limit {
+		nodeLimit = limit
+	}
+	return &workerPool{
+		ctx:       ctx,
+		global:    make(chan struct{}, limit),
+		nodeLimit: nodeLimit,
+		nodes:     map[string]chan struct{}{},
+	}
+}
+
+// Go : schedules job against node. Jobs may schedule further jobs before returning.
+func (p *workerPool) Go(node string, job func() error) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		nodeSlots := p.nodeSlots(node)
+		if !p.acquire(nodeSlots) {
+			return
+		}
+		defer func() { <-nodeSlots }()
+		if !p.acquire(p.global) {
+			return
+		}
+		defer func() { <-p.global }()
+
+		if err := job(); err != nil {
+			p.mu.Lock()
+			p.errs = append(p.errs, err)
+			p.mu.Unlock()
+		}
+	}()
+}
+
+// Wait : blocks until every scheduled job is done and returns the errors of the failed jobs
+func (p *workerPool) Wait() []error {
+	p.wg.Wait()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.skipped > 0 {
+		return append(p.errs, fmt.Errorf("%d collection steps skipped: %v", p.skipped, p.ctx.Err()))
+	}
+	return p.errs
+}
+
+func (p *workerPool) acquire(slots chan struct{}) bool {
+	select {
+	case slots <- struct{}{}:
+		if p.ctx.Err() == nil {
+			return true
+		}
+		<-slots
+	case <-p.ctx.Done():
+	}
+	p.mu.Lock()
+	p.skipped++
+	p.mu.Unlock()
+	return false
+}
+
+func (p *workerPool) nodeSlots(node string) chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	slots, ok := p.nodes[node]
+	if !ok {
+		slots = make(chan struct{}, p.nodeLimit)
+		p.nodes[node] = slots
+	}
+	return slots
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WorkerPoolRespectsLimits(t *testing.T) {
+	pool := newWorkerPool(context.Background(), 4, 1)
+	var lock sync.Mutex
+	running := map[string]int{}
+	var total, maxTotal int32
+	maxPerNode := 0
+
+	for i := 0; i < 20; i++ {
+		node := []string{"a", "b", "c"}[i%3]
+		pool.Go(node, func() error {
+			lock.Lock()
+			running[node]++
+			if running[node] > maxPerNode {
+				maxPerNode = running[node]
+			}
+			lock.Unlock()
+			current := atomic.AddInt32(&total, 1)
+			for {
+				seen := atomic.LoadInt32(&maxTotal)
+				if current <= seen || atomic.CompareAndSwapInt32(&maxTotal, seen, current) {
+					break
+				}
+			}
+			time.Sleep(2 * time.Millisecond)
+			atomic.AddInt32(&total, -1)
+			lock.Lock()
+			running[node]--
+			lock.Unlock()
+			return nil
+		})
+	}
+
+	assert.Empty(t, pool.Wait())
+	assert.Equal(t, 1, maxPerNode)
+	assert.True(t, maxTotal <= 3)
+}
+
+func Test_WorkerPoolNestedJobsAndErrors(t *testing.T) {
+	pool := newWorkerPool(context.Background(), 2, 2)
+	var done int32
+	pool.Go("a", func() error {
+		for i := 0; i < 5; i++ {
+			pool.Go("b", func() error {
+				atomic.AddInt32(&done, 1)
+				return nil
+			})
+		}
+		return errors.New("boom")
+	})
+	pool.Go("c", func() error {
+		return errors.New("bang")
+	})
+
+	errs := pool.Wait()
+	assert.Len(t, errs, 2)
+	assert.Contains(t, errs, errors.New("boom"))
+	assert.Contains(t, errs, errors.New("bang"))
+	assert.Equal(t, int32(5), done)
+}
+
+func Test_WorkerPoolSkipsJobsAfterDeadline(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	pool := newWorkerPool(ctx, 1, 1)
+	var done int32
+	pool.Go("a", func() error {
+		for i := 0; i < 3; i++ {
+			pool.Go("a", func() error {
+				atomic.AddInt32(&done, 1)
+				return nil
+			})
+		}
+		cancel()
+		return nil
+	})
+
+	errs := pool.Wait()
+	assert.Equal(t, int32(0), done)
+	assert.Len(t, errs, 1)
+	assert.EqualError(t, errs[0], "3 collection steps skipped: context canceled")
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/log"
+	"github.com/newrelic/infra-integrations-sdk/metric"
+	"github.com/newrelic/infra-integrations-sdk/sdk"
+)
+
+const (
+	prometheusBackend = "prometheus"
+
+	managementPort    = 8091
+	managementSSLPort = 18091
+)
+
+// promSample : one sample line of the exposition format
+type promSample struct {
+	name   string
+	labels map[string]string
+	value  float64
+}
+
+// parsePrometheusText : parses the Prometheus and OpenMetrics text exposition formats, returning the samples and the declared family types
+func parsePrometheusText(data []byte) ([]promSample, map[string]string, error) {
+	samples := []promSample{}
+	types := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(line)
+			if len(fields) >= 4 && fields[1] == "TYPE" {
+				types[fields[2]] = fields[3]
+			}
+			continue
+		}
+		sample, err := parsePrometheusLine(line)
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+		samples = append(samples, sample)
+	}
+	return samples, types, scanner.Err()
+}
+
+func parsePrometheusLine(line string) (promSample, error) {
+	sample := promSample{labels: map[string]string{}}
+	end := strings.IndexAny(line, "{ ")
+	if end <= 0 {
+		return sample, fmt.Errorf("missing metric value")
+	}
+	sample.name = line[:end]
+	rest := line[end:]
+
+	if rest[0] == '{' {
+		rest = rest[1:]
+		for {
+			rest = strings.TrimLeft(rest, " ,")
+			if strings.HasPrefix(rest, "}") {
+				rest = rest[1:]
+				break
+			}
+			eq := strings.Index(rest, "=")
+			if eq <= 0 || len(rest) < eq+2 || rest[eq+1] != '"' {
+				return sample, fmt.Errorf("malformed label set")
+			}
+			label := strings.TrimSpace(rest[:eq])
+			value, remaining, err := readLabelValue(rest[eq+2:])
+			if err != nil {
+				return sample, err
+			}
+			sample.labels[label] = value
+			rest = remaining
+		}
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return sample, fmt.Errorf("missing metric value")
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return sample, err
+	}
+	sample.value = value
+	return sample, nil
+}
+
+// readLabelValue : reads an escaped label value up to its closing quote
+func readLabelValue(s string) (string, string, error) {
+	var value strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 >= len(s) {
+				return "", "", fmt.Errorf("unterminated label value")
+			}
+			i++
+			if s[i] == 'n' {
+				value.WriteByte('\n')
+			} else {
+				value.WriteByte(s[i])
+			}
+		case '"':
+			return value.String(), s[i+1:], nil
+		default:
+			value.WriteByte(s[i])
+		}
+	}
+	return "", "", fmt.Errorf("unterminated label value")
+}
+
+func schedulePrometheusStats(ctx context.Context, pool *workerPool, integration *sdk.Integration, counters *counterStore, poolData []byte) error {
+	info, err := getDefaultPoolInfo(poolData)
+	if err != nil {
+		return err
+	}
+	nodeArg := strings.TrimSpace(args.Node)
+	for _, node := range info.Nodes {
+		if nodeArg != "all" && nodeArg != node.Hostname {
+			continue
+		}
+		node := node
+		pool.Go(node.Hostname, func() error {
+			metricsURL := serviceURL(node.Hostname, managementPort, managementSSLPort) + "/metrics"
+			log.Debug("Processing metrics at %s", metricsURL)
+			metricsData, err := httpGetURL(ctx, metricsURL)
+			if err == nil {
+				err = setPrometheusStats(integration, counters, node.Hostname, metricsData, prometheusFamilies(), strings.TrimSpace(args.Bucket), time.Now())
+			}
+			return collectionFailure(metricsURL, "", node.Hostname, err)
+		})
+	}
+	return nil
+}
+
+func prometheusFamilies() []string {
+	families := []string{}
+	for _, f := range strings.Split(args.PrometheusFamilies, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			families = append(families, f)
+		}
+	}
+	return families
+}
+
+// setPrometheusStats : samples of the selected families sharing a label set are reported in one CouchbaseSample, labels become attributes.
+// Counters, summaries and histograms are reported as per second rates of each series since the previous run, NaN and infinite samples are skipped.
+func setPrometheusStats(integration *sdk.Integration, counters *counterStore, hostname string, data []byte, families []string, bucketArg string, at time.Time) error {
+	samples, types, err := parsePrometheusText(data)
+	if err != nil {
+		return err
+	}
+
+	groups := map[string][]promSample{}
+	for _, sample := range samples {
+		if !hasAnyPrefix(sample.name, families) || strings.HasSuffix(sample.name, "_bucket") {
+			continue
+		}
+		if bucket, ok := sample.labels["bucket"]; ok && bucketArg != "all" && bucket != bucketArg {
+			continue
+		}
+		key := labelSetKey(sample.labels)
+		groups[key] = append(groups[key], sample)
+	}
+
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		group := groups[key]
+		ms := newMetricSet(integration, "CouchbaseSample")
+		ms.SetMetric("node", hostname, metric.ATTRIBUTE)
+		for label, value := range group[0].labels {
+			ms.SetMetric(label, value, metric.ATTRIBUTE)
+		}
+		for _, sample := range group {
+			// NaN and infinite values can't be published
+			if math.IsNaN(sample.value) || math.IsInf(sample.value, 0) {
+				continue
+			}
+			if !prometheusCumulative(sample.name, types) {
+				ms.SetMetric(sample.name, sample.value, metric.GAUGE)
+				continue
+			}
+			if r, ok := counters.rate(counterKey(clusterScope, key, hostname, sample.name), sample.value, at); ok && !math.IsNaN(r) && !math.IsInf(r, 0) {
+				ms.SetMetric(sample.name, r, metric.GAUGE)
+			}
+		}
+	}
+	return nil
+}
+
+// prometheusCumulative : samples of counter, summary and histogram families only grow
+func prometheusCumulative(name string, types map[string]string) bool {
+	family := name
+	for _, suffix := range []string{"_total", "_sum", "_count"} {
+		if _, ok := types[family]; !ok && strings.HasSuffix(name, suffix) {
+			family = strings.TrimSuffix(name, suffix)
+		}
+	}
+	switch types[family] {
+	case "counter", "summary", "histogram":
+		return true
+	}
+	return false
+}
+
+func labelSetKey(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, name+"="+strconv.Quote(labels[name]))
+	}
+	return strings.Join(parts, ",")
+}
+
+func hasAnyPrefix(name string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
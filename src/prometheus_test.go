@@ -0,0 +1,104 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/sdk"
+	"github.com/stretchr/testify/assert"
+)
+
+var prometheusText = `# HELP kv_ops Number of operations
+# TYPE kv_ops counter
+kv_ops{bucket="travel-sample",op="get",result="hit"} 1200
+kv_ops{bucket="travel-sample",op="get",result="miss"} 30
+kv_ops{bucket="beer-sample",op="get",result="hit"} 7
+# TYPE kv_curr_items gauge
+kv_curr_items{bucket="travel-sample"} 31591
+# TYPE n1ql_requests counter
+n1ql_requests 42 1616676000000
+# TYPE n1ql_request_time histogram
+n1ql_request_time_bucket{le="0.1"} 5
+n1ql_request_time_sum 1.5
+n1ql_request_time_count 6
+# TYPE index_num_docs_pending gauge
+index_num_docs_pending{bucket="travel-sample",index="def_type",collection="_default"} 2
+sys_cpu_utilization_rate 12.5
+fts_doc_count{bucket="travel-sample",index="travel \"fts\"\\idx"} 917
+kv_ep_cache_miss_ratio{bucket="travel-sample"} NaN
+n1ql_request_time_max +Inf
+# EOF
+`
+
+func Test_ParsePrometheusText(t *testing.T) {
+	samples, types, err := parsePrometheusText([]byte(prometheusText))
+
+	assert.Nil(t, err)
+	assert.Len(t, samples, 13)
+	assert.Equal(t, "counter", types["kv_ops"])
+	assert.Equal(t, "kv_ops", samples[0].name)
+	assert.Equal(t, map[string]string{"bucket": "travel-sample", "op": "get", "result": "hit"}, samples[0].labels)
+	assert.Equal(t, float64(1200), samples[0].value)
+	assert.Equal(t, float64(42), samples[4].value)
+	assert.Equal(t, `travel "fts"\idx`, samples[10].labels["index"])
+	assert.True(t, math.IsNaN(samples[11].value))
+	assert.True(t, math.IsInf(samples[12].value, 1))
+}
+
+func Test_ParsePrometheusTextMalformed(t *testing.T) {
+	_, _, err := parsePrometheusText([]byte(`kv_ops{bucket="travel-sample} 1`))
+
+	assert.NotNil(t, err)
+}
+
+func Test_SetPrometheusStats(t *testing.T) {
+	counters := &counterStore{entries: map[string]counterState{}}
+	at := time.Unix(1600000000, 0)
+	first := &sdk.Integration{}
+	err := setPrometheusStats(first, counters, "10.0.0.1:8091", []byte(prometheusText), []string{"kv_", "n1ql_", "index_"}, "travel-sample", at)
+	assert.Nil(t, err)
+	assert.NotContains(t, first.Metrics[0], "n1ql_requests")
+	assert.NotContains(t, first.Metrics[3], "kv_ops")
+
+	// every label set of a counter family gets its own rate
+	later := strings.NewReplacer(`result="hit"} 1200`, `result="hit"} 1500`, `result="miss"} 30`, `result="miss"} 40`, "n1ql_requests 42", "n1ql_requests 52").Replace(prometheusText)
+	integration := &sdk.Integration{}
+	err = setPrometheusStats(integration, counters, "10.0.0.1:8091", []byte(later), []string{"kv_", "n1ql_", "index_"}, "travel-sample", at.Add(10*time.Second))
+	assert.Nil(t, err)
+	assert.Len(t, integration.Metrics, 5)
+
+	requests := integration.Metrics[0]
+	assert.Equal(t, "CouchbaseSample", requests["event_type"])
+	assert.Equal(t, "10.0.0.1:8091", requests["node"])
+	assert.Equal(t, float64(1), requests["n1ql_requests"])
+	assert.Equal(t, float64(0), requests["n1ql_request_time_sum"])
+	assert.NotContains(t, requests, "n1ql_request_time_bucket")
+
+	items := integration.Metrics[1]
+	assert.Equal(t, "travel-sample", items["bucket"])
+	assert.Equal(t, float64(31591), items["kv_curr_items"])
+	assert.NotContains(t, items, "kv_ep_cache_miss_ratio")
+	assert.NotContains(t, requests, "n1ql_request_time_max")
+
+	pending := integration.Metrics[2]
+	assert.Equal(t, "def_type", pending["index"])
+	assert.Equal(t, float64(2), pending["index_num_docs_pending"])
+
+	hits := integration.Metrics[3]
+	assert.Equal(t, "hit", hits["result"])
+	assert.Equal(t, float64(30), hits["kv_ops"])
+	misses := integration.Metrics[4]
+	assert.Equal(t, "miss", misses["result"])
+	assert.Equal(t, float64(1), misses["kv_ops"])
+}
+
+func Test_PrometheusCumulative(t *testing.T) {
+	types := map[string]string{"kv_ops": "counter", "kv_curr_items": "gauge", "n1ql_request_time": "histogram"}
+
+	assert.True(t, prometheusCumulative("kv_ops", types))
+	assert.False(t, prometheusCumulative("kv_curr_items", types))
+	assert.True(t, prometheusCumulative("n1ql_request_time_count", types))
+	assert.False(t, prometheusCumulative("sys_cpu_utilization_rate", types))
+}
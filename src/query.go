@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+
+	"github.com/newrelic/infra-integrations-sdk/log"
+	"github.com/newrelic/infra-integrations-sdk/metric"
+	"github.com/newrelic/infra-integrations-sdk/sdk"
+)
+
+const (
+	queryPort    = 8093
+	querySSLPort = 18093
+)
+
+var queryVitalsMetrics = map[string]pickedMetric{
+	"version":                   pickedMetric{"version", "s", attribute},
+	"uptime":                    pickedMetric{"uptime", "s", gauge},
+	"cores":                     pickedMetric{"cores", "f", gauge},
+	"threads":                   pickedMetric{"total.threads", "f", gauge},
+	"request.completed.count":   pickedMetric{"request.completed.count", "f", gauge},
+	"request.active.count":      pickedMetric{"request.active.count", "f", gauge},
+	"request.per.sec.1min":      pickedMetric{"request.per.sec.1min", "f", gauge},
+	"request.per.sec.5min":      pickedMetric{"request.per.sec.5min", "f", gauge},
+	"request.per.sec.15min":     pickedMetric{"request.per.sec.15min", "f", gauge},
+	"request.prepared.percent":  pickedMetric{"request.prepared.percent", "f", gauge},
+	"request_time.mean":         pickedMetric{"request_time.mean", "s", gauge},
+	"request_time.median":       pickedMetric{"request_time.median", "s", gauge},
+	"request_time.80percentile": pickedMetric{"request_time.80percentile", "s", gauge},
+	"request_time.95percentile": pickedMetric{"request_time.95percentile", "s", gauge},
+	"request_time.99percentile": pickedMetric{"request_time.99percentile", "s", gauge},
+	"gc.num":                    pickedMetric{"gc.num", "f", gauge},
+	"gc.pause.time":             pickedMetric{"gc.pause.time", "s", gauge},
+	"gc.pause.percent":          pickedMetric{"gc.pause.percent", "f", gauge},
+	"memory.usage":              pickedMetric{"memory.usage", "f", gauge},
+	"memory.total":              pickedMetric{"memory.total", "f", gauge},
+	"memory.system":             pickedMetric{"memory.system", "f", gauge},
+	"cpu.user.percent":          pickedMetric{"cpu.user.percent", "f", gauge},
+	"cpu.sys.percent":           pickedMetric{"cpu.sys.percent", "f", gauge},
+}
+
+var queryStatsMetrics = map[string]pickedMetric{
+	"active_requests.count":  pickedMetric{"active_requests.count", "f", gauge},
+	"queued_requests.count":  pickedMetric{"queued_requests.count", "f", gauge},
+	"requests.count":         pickedMetric{"requests.count", "f", gauge},
+	"request_rate.1m":        pickedMetric{"request_rate.1m.rate", "f", gauge},
+	"errors.count":           pickedMetric{"errors.count", "f", gauge},
+	"warnings.count":         pickedMetric{"warnings.count", "f", gauge},
+	"invalid_requests.count": pickedMetric{"invalid_requests.count", "f", gauge},
+	"requests_250ms.count":   pickedMetric{"requests_250ms.count", "f", gauge},
+	"requests_500ms.count":   pickedMetric{"requests_500ms.count", "f", gauge},
+	"requests_1000ms.count":  pickedMetric{"requests_1000ms.count", "f", gauge},
+	"requests_5000ms.count":  pickedMetric{"requests_5000ms.count", "f", gauge},
+	"result_count.count":     pickedMetric{"result_count.count", "f", gauge},
+	"result_size.count":      pickedMetric{"result_size.count", "f", gauge},
+}
+
+func populateQueryStats(ctx context.Context, integration *sdk.Integration, node nodeInfo) error {
+	queryURL := serviceURL(node.Hostname, queryPort, querySSLPort)
+	log.Debug("Processing query metrics at %s", queryURL)
+	vitalsData, err := httpGetURL(ctx, queryURL+"/admin/vitals")
+	if err != nil {
+		return collectionFailure(queryURL+"/admin/vitals", "", node.Hostname, err)
+	}
+	statsData, err := httpGetURL(ctx, queryURL+"/admin/stats")
+	if err != nil {
+		return collectionFailure(queryURL+"/admin/stats", "", node.Hostname, err)
+	}
+
+	setQueryStats(integration, node.Hostname, vitalsData, statsData)
+	return nil
+}
+
+func setQueryStats(integration *sdk.Integration, hostname string, vitalsData []byte, statsData []byte) {
+	ms := newMetricSet(integration, "CouchbaseQuerySample")
+	ms.SetMetric("node", hostname, metric.ATTRIBUTE)
+	setPickedMetrics(ms, vitalsData, queryVitalsMetrics)
+	setPickedMetrics(ms, statsData, queryStatsMetrics)
+}
+
+// serviceURL : base URL of a service port on the node reported as hostname by the cluster
+func serviceURL(hostname string, port int, sslPort int) string {
+	protocol := "http://"
+	if args.SSL {
+		protocol = "https://"
+		port = sslPort
+	}
+	return protocol + nodeAddress(hostname, port)
+}
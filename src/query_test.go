@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/newrelic/infra-integrations-sdk/sdk"
+	"github.com/stretchr/testify/assert"
+)
+
+var queryVitalsJSON = `{
+	"uptime": "1h0m0s",
+	"version": "1.7.0",
+	"total.threads": 200,
+	"cores": 4,
+	"gc.num": 1200,
+	"gc.pause.time": "25ms",
+	"gc.pause.percent": 0,
+	"memory.usage": 5000000,
+	"request.completed.count": 1000,
+	"request.active.count": 3,
+	"request.per.sec.1min": 12.5,
+	"request_time.mean": "536.2µs",
+	"request_time.99percentile": "1.5s"
+}`
+
+var queryStatsJSON = `{
+	"active_requests.count": 3,
+	"queued_requests.count": 1,
+	"errors.count": 7,
+	"request_rate.1m.rate": 12.2
+}`
+
+func Test_SetQueryStats(t *testing.T) {
+	integration := &sdk.Integration{}
+
+	setQueryStats(integration, "10.0.0.1:8091", []byte(queryVitalsJSON), []byte(queryStatsJSON))
+
+	assert.Len(t, integration.Metrics, 1)
+	ms := integration.Metrics[0]
+	assert.Equal(t, "CouchbaseQuerySample", ms["event_type"])
+	assert.Equal(t, "10.0.0.1:8091", ms["node"])
+	assert.Equal(t, "1.7.0", ms["version"])
+	assert.Equal(t, float64(3600000), ms["uptime"])
+	assert.Equal(t, float64(25), ms["gc.pause.time"])
+	assert.InDelta(t, 0.5362, ms["request_time.mean"], 0.0001)
+	assert.Equal(t, float64(1500), ms["request_time.99percentile"])
+	assert.Equal(t, float64(1), ms["queued_requests.count"])
+	assert.Equal(t, float64(7), ms["errors.count"])
+	assert.Equal(t, 12.2, ms["request_rate.1m"])
+	assert.NotContains(t, ms, "memory.total")
+}
+
+func Test_ServiceURL(t *testing.T) {
+	defer func(ssl bool) { args.SSL = ssl }(args.SSL)
+
+	args.SSL = false
+	assert.Equal(t, "http://10.0.0.1:8093", serviceURL("10.0.0.1:8091", queryPort, querySSLPort))
+	assert.Equal(t, "http://[fd00::1]:8093", serviceURL("[fd00::1]:8091", queryPort, querySSLPort))
+
+	args.SSL = true
+	assert.Equal(t, "https://cb1.example.com:18093", serviceURL("cb1.example.com:8091", queryPort, querySSLPort))
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/newrelic/infra-integrations-sdk/log"
+	"github.com/newrelic/infra-integrations-sdk/metric"
+	"github.com/newrelic/infra-integrations-sdk/sdk"
+)
+
+func rawSampleMetrics() []string {
+	names := []string{}
+	for _, name := range strings.Split(args.RawSamples, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// setRawSamples : one CouchbaseRawSample per stats sample timestamp at indexes, carrying the samples of the named stats
+func setRawSamples(integration *sdk.Integration, bucketName string, hostName string, statsData []byte, timestamps []float64, indexes []int, names []string) {
+	if len(timestamps) == 0 {
+		return
+	}
+	samples := map[string][]float64{}
+	for _, metricName := range names {
+		def := configuredMetrics[metricName]
+		var values []float64
+		config := Config{
+			Properties: []Property{
+				{Path: def.statsPath(metricName), Type: "[f]"},
+			},
+		}
+		err := PickDeserializedUsingConfig(bytes.NewReader(statsData), config, metricName, &values)
+		if err != nil || len(values) != len(timestamps) {
+			log.Debug("Skipping raw samples of %s", metricName)
+			continue
+		}
+		samples[def.reportedName(metricName)] = values
+	}
+	if len(samples) == 0 {
+		return
+	}
+
+	for _, i := range indexes {
+		ms := newMetricSet(integration, "CouchbaseRawSample")
+		ms.SetMetric("bucket", bucketName, metric.ATTRIBUTE)
+		ms.SetMetric("node", hostName, metric.ATTRIBUTE)
+		ms.SetMetric("timestamp", int64(timestamps[i]), metric.ATTRIBUTE)
+		for name, values := range samples {
+			ms.SetMetric(name, values[i], metric.GAUGE)
+		}
+	}
+}
+
+func addRangeRawSamples(raw map[bucketNode]map[int64]map[string]float64, key bucketNode, name string, timestamps []int64, values []float64) {
+	if _, ok := raw[key]; !ok {
+		raw[key] = map[int64]map[string]float64{}
+	}
+	for i, ts := range timestamps {
+		if _, ok := raw[key][ts]; !ok {
+			raw[key][ts] = map[string]float64{}
+		}
+		raw[key][ts][name] += values[i]
+	}
+}
+
+// setRangeRawSamples : one CouchbaseRawSample per stats range timestamp, the samples are already past the cursors
+func setRangeRawSamples(integration *sdk.Integration, raw map[bucketNode]map[int64]map[string]float64) {
+	keys := make([]bucketNode, 0, len(raw))
+	for key := range raw {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].bucket != keys[j].bucket {
+			return keys[i].bucket < keys[j].bucket
+		}
+		return keys[i].node < keys[j].node
+	})
+	for _, key := range keys {
+		timestamps := make([]int64, 0, len(raw[key]))
+		for ts := range raw[key] {
+			timestamps = append(timestamps, ts)
+		}
+		sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+		for _, ts := range timestamps {
+			ms := newMetricSet(integration, "CouchbaseRawSample")
+			ms.SetMetric("bucket", key.bucket, metric.ATTRIBUTE)
+			ms.SetMetric("node", key.node, metric.ATTRIBUTE)
+			ms.SetMetric("timestamp", ts, metric.ATTRIBUTE)
+			for name, value := range raw[key][ts] {
+				ms.SetMetric(name, value, metric.GAUGE)
+			}
+		}
+	}
+}
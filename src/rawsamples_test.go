@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/sdk"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_RawSampleMetrics(t *testing.T) {
+	defer func(raw string) { args.RawSamples = raw }(args.RawSamples)
+
+	args.RawSamples = ""
+	assert.Empty(t, rawSampleMetrics())
+
+	args.RawSamples = " cmd_get, ,ep_bg_fetched "
+	assert.Equal(t, []string{"cmd_get", "ep_bg_fetched"}, rawSampleMetrics())
+}
+
+func Test_SetRawSamples(t *testing.T) {
+	defer func(metrics map[string]metricDef) { configuredMetrics = metrics }(configuredMetrics)
+	configuredMetrics = map[string]metricDef{"cmd_get": metricDef{metricT: gauge, metricN: "gets"}}
+	integration := &sdk.Integration{}
+	timestamps := []float64{1000, 2000, 3000, 4000}
+
+	setRawSamples(integration, "travel-sample", "10.0.0.1:8091", []byte(cursorStatsJSON), timestamps, []int{2, 3}, []string{"cmd_get", "mem_used", "missing"})
+
+	assert.Len(t, integration.Metrics, 2)
+	first := integration.Metrics[0]
+	assert.Equal(t, "CouchbaseRawSample", first["event_type"])
+	assert.Equal(t, "travel-sample", first["bucket"])
+	assert.Equal(t, "10.0.0.1:8091", first["node"])
+	assert.Equal(t, int64(3000), first["timestamp"])
+	assert.Equal(t, float64(30), first["gets"])
+	assert.Equal(t, float64(1), first["mem_used"])
+	assert.NotContains(t, first, "missing")
+	assert.Equal(t, int64(4000), integration.Metrics[1]["timestamp"])
+	assert.Equal(t, float64(5), integration.Metrics[1]["mem_used"])
+}
+
+func Test_SetRangeStatsRawSamples(t *testing.T) {
+	defer func(raw string) { args.RawSamples = raw }(args.RawSamples)
+	args.RawSamples = "cmd_get"
+	cursors := &sampleCursors{previous: map[string]float64{"travel-sample/10.0.0.1:8091": 1000}, current: map[string]float64{}}
+	integration := &sdk.Integration{}
+
+	err := setRangeStats(integration, cursors, &counterStore{entries: map[string]counterState{}}, []string{"cmd_get", "mem_used"}, []byte(rangeStatsJSON), time.Now())
+
+	assert.Nil(t, err)
+	assert.Len(t, integration.Metrics, 4)
+	newer := integration.Metrics[2]
+	assert.Equal(t, "CouchbaseRawSample", newer["event_type"])
+	assert.Equal(t, "10.0.0.1:8091", newer["node"])
+	assert.Equal(t, int64(2000), newer["timestamp"])
+	assert.Equal(t, float64(20), newer["cmd_get"])
+	assert.NotContains(t, newer, "mem_used")
+	first := integration.Metrics[3]
+	assert.Equal(t, "10.0.0.2:8091", first["node"])
+	assert.Equal(t, int64(1000), first["timestamp"])
+	assert.Equal(t, float64(4), first["cmd_get"])
+	assert.Equal(t, map[string]float64{"travel-sample/10.0.0.1:8091": 2000, "travel-sample/10.0.0.2:8091": 1000}, cursors.current)
+}
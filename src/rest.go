@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/log"
+)
+
+const maxRetryBackoff = 5 * time.Second
+
+type restErrorKind int
+
+const (
+	requestError restErrorKind = iota
+	authError
+	permissionError
+	notFoundError
+	serverError
+	timeoutError
+)
+
+var restErrorKinds = map[restErrorKind]string{
+	requestError:    "request",
+	authError:       "auth",
+	permissionError: "permission",
+	notFoundError:   "not-found",
+	serverError:     "server-error",
+	timeoutError:    "timeout",
+}
+
+func (k restErrorKind) String() string {
+	return restErrorKinds[k]
+}
+
+// restError : a failed REST call, message is decoded from the Couchbase error body
+type restError struct {
+	kind    restErrorKind
+	method  string
+	url     string
+	status  int
+	message string
+}
+
+func (e *restError) Error() string {
+	call := e.method + " " + e.url
+	if e.status == 0 {
+		return fmt.Sprintf("%s: %s: %s", call, e.kind, e.message)
+	}
+	if e.message == "" {
+		return fmt.Sprintf("%s: %s (%d)", call, e.kind, e.status)
+	}
+	return fmt.Sprintf("%s: %s (%d): %s", call, e.kind, e.status, e.message)
+}
+
+// isRESTError : reports whether err, or the cause of a collection error, is a REST error of kind
+func isRESTError(err error, kind restErrorKind) bool {
+	if failure, ok := err.(*collectionError); ok {
+		err = failure.cause
+	}
+	e, ok := err.(*restError)
+	return ok && e.kind == kind
+}
+
+func httpGet(ctx context.Context, uri string) ([]byte, error) {
+	return httpGetURL(ctx, baseURL+uri)
+}
+
+func httpGetURL(ctx context.Context, url string) ([]byte, error) {
+	return httpDo(ctx, "GET", url, "", nil)
+}
+
+func httpPost(ctx context.Context, uri string, contentType string, body []byte) ([]byte, error) {
+	return httpDo(ctx, "POST", baseURL+uri, contentType, body)
+}
+
+// httpDo : GET requests failing with a timeout, a server error or a connection error are retried with exponential backoff and jitter
+func httpDo(ctx context.Context, method string, url string, contentType string, body []byte) ([]byte, error) {
+	attempts := 1
+	if method == "GET" && args.Retries > 0 {
+		attempts += args.Retries
+	}
+	backoff := time.Duration(args.RetryBackoff) * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		data, err := httpAttempt(ctx, method, url, contentType, body)
+		if err == nil || attempt >= attempts || !retryable(ctx, err) {
+			return data, err
+		}
+		wait := jitter(backoff)
+		log.Debug("Retrying %s %s in %v: %v", method, url, wait, err)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, err
+		}
+		if backoff *= 2; backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
+
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if e, ok := err.(*restError); ok {
+		return e.kind == serverError || e.kind == timeoutError
+	}
+	return retryableCause(err)
+}
+
+// retryableCause : timeouts, refused or reset connections and truncated responses may succeed on a retry,
+// certificate, hostname verification and URL errors can't
+func retryableCause(err error) bool {
+	for err != nil {
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			return true
+		}
+		switch e := err.(type) {
+		case *url.Error:
+			err = e.Err
+		case *net.OpError:
+			err = e.Err
+		case *os.SyscallError:
+			err = e.Err
+		case syscall.Errno:
+			return e == syscall.ECONNREFUSED || e == syscall.ECONNRESET
+		default:
+			return err == io.ErrUnexpectedEOF
+		}
+	}
+	return false
+}
+
+// jitter : a random duration between half of d and d
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// httpAttempt : the body of responses other than 2xx is returned as a restError
+func httpAttempt(ctx context.Context, method string, url string, contentType string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	// without a username the client certificate authenticates
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	response, err := httpClient.Do(req)
+	if err != nil {
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			return nil, &restError{kind: timeoutError, method: method, url: url, message: err.Error()}
+		}
+		return nil, err
+	}
+	defer response.Body.Close()
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			return nil, &restError{kind: timeoutError, method: method, url: url, message: err.Error()}
+		}
+		return nil, err
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return nil, &restError{
+			kind:    statusErrorKind(response.StatusCode),
+			method:  method,
+			url:     url,
+			status:  response.StatusCode,
+			message: decodeErrorBody(data),
+		}
+	}
+	return data, nil
+}
+
+func statusErrorKind(status int) restErrorKind {
+	switch {
+	case status == http.StatusUnauthorized:
+		return authError
+	case status == http.StatusForbidden:
+		return permissionError
+	case status == http.StatusNotFound:
+		return notFoundError
+	case status == http.StatusRequestTimeout || status == http.StatusGatewayTimeout:
+		return timeoutError
+	case status >= 500:
+		return serverError
+	}
+	return requestError
+}
+
+const maxErrorBodyLength = 256
+
+// decodeErrorBody : Couchbase errors come as {"message", "permissions"}, {"error", "reason"},
+// {"errors": {field: message}}, a list of messages or plain text
+func decodeErrorBody(data []byte) string {
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		message := strings.TrimSpace(string(data))
+		if len(message) > maxErrorBodyLength {
+			message = message[:maxErrorBodyLength] + "..."
+		}
+		return message
+	}
+	return errorMessage(decoded)
+}
+
+func errorMessage(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case []interface{}:
+		messages := []string{}
+		for _, item := range v {
+			if m := errorMessage(item); m != "" {
+				messages = append(messages, m)
+			}
+		}
+		return strings.Join(messages, "; ")
+	case map[string]interface{}:
+		for _, key := range []string{"message", "error", "errors"} {
+			m := errorMessage(v[key])
+			if m == "" {
+				continue
+			}
+			if reason := errorMessage(v["reason"]); reason != "" {
+				m += ": " + reason
+			}
+			if permissions := errorMessage(v["permissions"]); permissions != "" {
+				m += " (" + permissions + ")"
+			}
+			return m
+		}
+		fields := make([]string, 0, len(v))
+		for field := range v {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		messages := []string{}
+		for _, field := range fields {
+			if m := errorMessage(v[field]); m != "" {
+				messages = append(messages, field+": "+m)
+			}
+		}
+		return strings.Join(messages, "; ")
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"io/ioutil"
+	stdlog "log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/sdk"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_HttpDoStatusErrors(t *testing.T) {
+	responses := map[string]struct {
+		status int
+		body   string
+	}{
+		"/ok":        {200, `{"name": "default"}`},
+		"/auth":      {401, ``},
+		"/forbidden": {403, `{"message": "Forbidden. User needs the following permissions", "permissions": ["cluster.bucket[beer].stats!read"]}`},
+		"/missing":   {404, "Requested resource not found.\r\n"},
+		"/server":    {500, `["Unexpected server error, request logged."]`},
+		"/invalid":   {400, `{"errors": {"start": "must be an integer"}}`},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response := responses[r.URL.Path]
+		w.WriteHeader(response.status)
+		w.Write([]byte(response.body))
+	}))
+	defer server.Close()
+
+	data, err := httpGetURL(context.Background(), server.URL+"/ok")
+	assert.Nil(t, err)
+	assert.Equal(t, `{"name": "default"}`, string(data))
+
+	_, err = httpGetURL(context.Background(), server.URL+"/auth")
+	assert.True(t, isRESTError(err, authError))
+	assert.EqualError(t, err, "GET "+server.URL+"/auth: auth (401)")
+
+	_, err = httpGetURL(context.Background(), server.URL+"/forbidden")
+	assert.True(t, isRESTError(err, permissionError))
+	assert.Equal(t, "Forbidden. User needs the following permissions (cluster.bucket[beer].stats!read)", err.(*restError).message)
+
+	_, err = httpGetURL(context.Background(), server.URL+"/missing")
+	assert.True(t, isRESTError(collectionFailure("/missing", "beer", "", err), notFoundError))
+	assert.Equal(t, "Requested resource not found.", err.(*restError).message)
+
+	_, err = httpGetURL(context.Background(), server.URL+"/server")
+	assert.True(t, isRESTError(err, serverError))
+	assert.EqualError(t, err, "GET "+server.URL+"/server: server-error (500): Unexpected server error, request logged.")
+
+	_, err = httpDo(context.Background(), "POST", server.URL+"/invalid", "application/json", []byte(`{}`))
+	assert.True(t, isRESTError(err, requestError))
+	assert.Equal(t, "start: must be an integer", err.(*restError).message)
+}
+
+func Test_HttpDoTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer server.Close()
+	defer func(client *http.Client) { httpClient = client }(httpClient)
+	httpClient = &http.Client{Timeout: 10 * time.Millisecond}
+
+	_, err := httpGetURL(context.Background(), server.URL+"/pools/default")
+	assert.True(t, isRESTError(err, timeoutError))
+}
+
+func Test_HttpDoRetriesGets(t *testing.T) {
+	defer func(retries int, backoff int) { args.Retries, args.RetryBackoff = retries, backoff }(args.Retries, args.RetryBackoff)
+	args.Retries, args.RetryBackoff = 2, 1
+	calls := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls[r.Method+" "+r.URL.Path]++
+		switch {
+		case r.URL.Path == "/flaky" && calls["GET /flaky"] < 3:
+			w.WriteHeader(503)
+		case r.URL.Path == "/missing", r.URL.Path == "/down":
+			w.WriteHeader(map[string]int{"/missing": 404, "/down": 500}[r.URL.Path])
+		}
+	}))
+	defer server.Close()
+
+	_, err := httpGetURL(context.Background(), server.URL+"/flaky")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, calls["GET /flaky"])
+
+	_, err = httpGetURL(context.Background(), server.URL+"/down")
+	assert.True(t, isRESTError(err, serverError))
+	assert.Equal(t, 3, calls["GET /down"])
+
+	_, err = httpGetURL(context.Background(), server.URL+"/missing")
+	assert.True(t, isRESTError(err, notFoundError))
+	assert.Equal(t, 1, calls["GET /missing"])
+
+	_, err = httpDo(context.Background(), "POST", server.URL+"/down", "application/json", nil)
+	assert.True(t, isRESTError(err, serverError))
+	assert.Equal(t, 1, calls["POST /down"])
+}
+
+func Test_HttpDoDoesNotRetryUntrustedCertificates(t *testing.T) {
+	defer func(retries int, backoff int) { args.Retries, args.RetryBackoff = retries, backoff }(args.Retries, args.RetryBackoff)
+	args.Retries, args.RetryBackoff = 3, 1
+	connections := 0
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Config.ErrorLog = stdlog.New(ioutil.Discard, "", 0)
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connections++
+		}
+	}
+	server.StartTLS()
+	defer server.Close()
+	defer func(client *http.Client) { httpClient = client }(httpClient)
+	httpClient = newHTTPClient(&tls.Config{MinVersion: tls.VersionTLS12})
+
+	_, err := httpGetURL(context.Background(), server.URL+"/pools")
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, connections)
+}
+
+func Test_RetryableCause(t *testing.T) {
+	refused := &url.Error{Op: "Get", URL: "http://h1:8091", Err: &net.OpError{Op: "dial", Err: &os.SyscallError{Syscall: "connect", Err: syscall.ECONNREFUSED}}}
+	reset := &net.OpError{Op: "read", Err: &os.SyscallError{Syscall: "read", Err: syscall.ECONNRESET}}
+
+	assert.True(t, retryableCause(refused))
+	assert.True(t, retryableCause(reset))
+	assert.True(t, retryableCause(&url.Error{Op: "Get", URL: "http://h1:8091", Err: io.ErrUnexpectedEOF}))
+	assert.False(t, retryableCause(&url.Error{Op: "Get", URL: "https://h1:18091", Err: x509.UnknownAuthorityError{}}))
+	assert.False(t, retryableCause(&url.Error{Op: "Get", URL: "https://h1:18091", Err: x509.HostnameError{Host: "h1"}}))
+	assert.False(t, retryableCause(&url.Error{Op: "parse", URL: "http://[h1", Err: errors.New("missing ']' in host")}))
+}
+
+func Test_HttpDoStopsAtDeadline(t *testing.T) {
+	defer func(retries int, backoff int) { args.Retries, args.RetryBackoff = retries, backoff }(args.Retries, args.RetryBackoff)
+	args.Retries, args.RetryBackoff = 5, 1000
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := httpGetURL(ctx, server.URL+"/pools/default")
+	assert.True(t, isRESTError(err, timeoutError))
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func Test_Jitter(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		wait := jitter(100 * time.Millisecond)
+		assert.True(t, wait >= 50*time.Millisecond && wait <= 100*time.Millisecond)
+	}
+	assert.Equal(t, time.Duration(0), jitter(0))
+}
+
+func Test_DecodeErrorBody(t *testing.T) {
+	assert.Equal(t, "Bucket not found: beer", decodeErrorBody([]byte(`{"error": "Bucket not found", "reason": "beer"}`)))
+	assert.Equal(t, "ramQuota: too small; name: taken", decodeErrorBody([]byte(`{"errors": ["ramQuota: too small", "name: taken"]}`)))
+	assert.Equal(t, "", decodeErrorBody(nil))
+}
+
+func Test_SetCollectionErrorsReportsErrorType(t *testing.T) {
+	integration := &sdk.Integration{}
+	err := &restError{kind: authError, method: "GET", url: "http://localhost:8091/pools/default", status: 401}
+	setCollectionErrors(integration, []error{collectionFailure("/pools/default", "", "", err)})
+	assert.Equal(t, "auth", integration.Metrics[0]["errorType"])
+	assert.Equal(t, 401, integration.Metrics[0]["status"])
+}
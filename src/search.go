@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/newrelic/infra-integrations-sdk/log"
+	"github.com/newrelic/infra-integrations-sdk/metric"
+	"github.com/newrelic/infra-integrations-sdk/sdk"
+)
+
+const (
+	searchPort    = 8094
+	searchSSLPort = 18094
+)
+
+var searchIndexMetrics = map[string]metricDef{
+	"doc_count":                    metricDef{metricT: gauge},
+	"num_mutations_to_index":       metricDef{metricT: gauge},
+	"num_pindexes_actual":          metricDef{metricT: gauge},
+	"num_pindexes_target":          metricDef{metricT: gauge},
+	"num_recs_to_persist":          metricDef{metricT: gauge},
+	"num_bytes_used_disk":          metricDef{metricT: gauge},
+	"total_bytes_indexed":          metricDef{metricT: gauge},
+	"total_queries":                metricDef{metricT: gauge},
+	"total_queries_error":          metricDef{metricT: gauge},
+	"total_queries_slow":           metricDef{metricT: gauge},
+	"total_queries_timeout":        metricDef{metricT: gauge},
+	"total_request_time":           metricDef{metricT: gauge},
+	"avg_queries_latency":          metricDef{metricT: gauge},
+	"total_term_searchers":         metricDef{metricT: gauge},
+	"total_compactions":            metricDef{metricT: gauge},
+	"total_internal_queries":       metricDef{metricT: gauge},
+	"avg_internal_queries_latency": metricDef{metricT: gauge},
+	"total_grpc_queries_error":     metricDef{metricT: gauge},
+}
+
+var searchNodeMetrics = map[string]metricDef{
+	"num_bytes_used_ram":               metricDef{metricT: gauge},
+	"pct_cpu_gc":                       metricDef{metricT: gauge},
+	"total_queries_rejected_by_herder": metricDef{metricT: gauge},
+	"tot_queryreject_on_memquota":      metricDef{metricT: gauge},
+	"curr_batches_blocked_by_herder":   metricDef{metricT: gauge},
+	"num_gocbcore_dcp_agents":          metricDef{metricT: gauge},
+}
+
+func populateSearchStats(ctx context.Context, integration *sdk.Integration, node nodeInfo) error {
+	searchURL := serviceURL(node.Hostname, searchPort, searchSSLPort)
+	log.Debug("Processing search metrics at %s", searchURL)
+	statsData, err := httpGetURL(ctx, searchURL+"/api/nsstats")
+	if err == nil {
+		err = setSearchStats(integration, node.Hostname, statsData, strings.TrimSpace(args.Bucket))
+	}
+	return collectionFailure(searchURL+"/api/nsstats", "", node.Hostname, err)
+}
+
+// setSearchStats : one sample per full text index, plus one sample without an index attribute for the node wide stats
+func setSearchStats(integration *sdk.Integration, hostname string, statsData []byte, bucketArg string) error {
+	indexes, nodeStats, err := groupIndexStats(statsData, bucketArg, searchIndexMetrics)
+	if err != nil {
+		return err
+	}
+	for _, idx := range sortedIndexKeys(indexes) {
+		ms := newMetricSet(integration, "CouchbaseSearchSample")
+		setIndexAttributes(ms, idx, hostname)
+		for statName, v := range indexes[idx] {
+			ms.SetMetric(statName, v, sourceType(searchIndexMetrics[statName].metricT))
+		}
+	}
+
+	ms := newMetricSet(integration, "CouchbaseSearchSample")
+	ms.SetMetric("node", hostname, metric.ATTRIBUTE)
+	for statName, def := range searchNodeMetrics {
+		if v, ok := nodeStats[statName]; ok {
+			ms.SetMetric(statName, v, sourceType(def.metricT))
+		}
+	}
+	return nil
+}
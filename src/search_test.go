@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/newrelic/infra-integrations-sdk/sdk"
+	"github.com/stretchr/testify/assert"
+)
+
+var searchStatsJSON = `{
+	"num_bytes_used_ram": 104857600,
+	"pct_cpu_gc": 0.5,
+	"total_queries_rejected_by_herder": 0,
+	"travel-sample:travel-fts:doc_count": 31591,
+	"travel-sample:travel-fts:num_mutations_to_index": 12,
+	"travel-sample:travel-fts:avg_queries_latency": 3.2,
+	"travel-sample:travel-fts:total_queries_error": 1,
+	"travel-sample:travel-fts:num_bytes_used_disk": 4096,
+	"travel-sample:hotels:doc_count": 917
+}`
+
+func Test_SetSearchStats(t *testing.T) {
+	integration := &sdk.Integration{}
+
+	err := setSearchStats(integration, "10.0.0.3:8091", []byte(searchStatsJSON), "all")
+
+	assert.Nil(t, err)
+	assert.Len(t, integration.Metrics, 3)
+
+	hotels := integration.Metrics[0]
+	assert.Equal(t, "CouchbaseSearchSample", hotels["event_type"])
+	assert.Equal(t, "hotels", hotels["index"])
+	assert.Equal(t, float64(917), hotels["doc_count"])
+
+	travel := integration.Metrics[1]
+	assert.Equal(t, "travel-sample", travel["bucket"])
+	assert.Equal(t, "travel-fts", travel["index"])
+	assert.Equal(t, "10.0.0.3:8091", travel["node"])
+	assert.Equal(t, float64(12), travel["num_mutations_to_index"])
+	assert.Equal(t, 3.2, travel["avg_queries_latency"])
+	assert.Equal(t, float64(1), travel["total_queries_error"])
+
+	node := integration.Metrics[2]
+	assert.NotContains(t, node, "index")
+	assert.Equal(t, "10.0.0.3:8091", node["node"])
+	assert.Equal(t, float64(104857600), node["num_bytes_used_ram"])
+	assert.Equal(t, 0.5, node["pct_cpu_gc"])
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/newrelic/infra-integrations-sdk/log"
+)
+
+// seedURLs : management URLs of the seed hosts, baseURL is the first one answering the cluster wide endpoints
+var seedURLs []string
+
+// clusterScope : identifies the monitored cluster in the state, the cluster uuid or the seed list until it is known
+var clusterScope string
+
+// parseSeeds : host is a host, a comma separated list of hosts or a couchbase:// or couchbases:// connection string.
+// Hosts without a port use port, couchbases:// implies ssl.
+func parseSeeds(host string, port int, ssl bool) ([]string, bool, error) {
+	host = strings.TrimSpace(host)
+	if i := strings.Index(host, "://"); i >= 0 {
+		switch strings.ToLower(host[:i]) {
+		case "couchbase":
+		case "couchbases":
+			if !ssl && port == managementPort {
+				port = managementSSLPort
+			}
+			ssl = true
+		default:
+			return nil, ssl, fmt.Errorf("unsupported connection string scheme '%s'", host[:i])
+		}
+		host = host[i+3:]
+		// bucket names and options of SDK connection strings are not used
+		if j := strings.IndexAny(host, "/?"); j >= 0 {
+			host = host[:j]
+		}
+	}
+
+	protocol := "http://"
+	if ssl {
+		protocol = "https://"
+	}
+	seeds := []string{}
+	for _, h := range strings.Split(host, ",") {
+		if h = strings.TrimSpace(h); h == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(h); err != nil {
+			h = net.JoinHostPort(strings.Trim(h, "[]"), fmt.Sprint(port))
+		}
+		seeds = append(seeds, protocol+h)
+	}
+	if len(seeds) == 0 {
+		return nil, ssl, fmt.Errorf("no host in '%s'", host)
+	}
+	return seeds, ssl, nil
+}
+
+// resolveClusterScope : keys the state by the cluster uuid reported by /pools, so reordering or adding seeds keeps it.
+// The seed list stays the scope when /pools doesn't report a uuid, as on a node not part of a cluster yet.
+func resolveClusterScope(ctx context.Context) error {
+	poolsData, err := httpGet(ctx, "/pools")
+	if err != nil {
+		return err
+	}
+	cluster, err := getClusterInfo(poolsData)
+	if err != nil {
+		return err
+	}
+	if cluster.UUID != "" {
+		clusterScope = cluster.UUID
+	}
+	return nil
+}
+
+// selectSeed : makes the first seed answering /pools the base URL of the cluster wide endpoints.
+// A seed answering with an error status is up and is kept, the error is reported by the collection steps.
+func selectSeed(ctx context.Context) error {
+	if len(seedURLs) < 2 {
+		return nil
+	}
+	var errs collectionErrors
+	for _, seed := range seedURLs {
+		_, err := httpAttempt(ctx, "GET", seed+"/pools", "", nil)
+		if e, ok := err.(*restError); err == nil || (ok && e.kind != serverError && e.kind != timeoutError) {
+			if baseURL != seed {
+				log.Debug("Using seed host %s", seed)
+			}
+			baseURL = seed
+			return nil
+		}
+		log.Debug("Seed host %s is not answering: %v", seed, err)
+		errs = append(errs, collectionFailure(seed+"/pools", "", "", err))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return errs
+}
+
+// seedNode : host:port of the seed answering as the cluster reports its nodes,
+// the worker pool key of the cluster wide requests so the seed node shares the limit of its per node requests
+func seedNode() string {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return baseURL
+	}
+	if u.Port() == strconv.Itoa(managementSSLPort) {
+		return net.JoinHostPort(u.Hostname(), strconv.Itoa(managementPort))
+	}
+	return u.Host
+}
+
+// nodeURL : management URL of a node from the hostname reported by the cluster
+func nodeURL(hostname string) string {
+	if !args.SSL {
+		if _, p, err := net.SplitHostPort(hostname); err == nil {
+			if port, err := strconv.Atoi(p); err == nil {
+				return "http://" + nodeAddress(hostname, port)
+			}
+		}
+	}
+	return serviceURL(hostname, managementPort, managementSSLPort)
+}
+
+// connectionOption : value of an option of a couchbase:// connection string
+func connectionOption(host string, name string) string {
+	i := strings.Index(host, "?")
+	if i < 0 || !strings.Contains(host, "://") {
+		return ""
+	}
+	values, err := url.ParseQuery(host[i+1:])
+	if err != nil {
+		return ""
+	}
+	return values.Get(name)
+}
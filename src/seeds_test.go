@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseSeeds(t *testing.T) {
+	seeds, ssl, err := parseSeeds("localhost", 8091, false)
+	assert.Nil(t, err)
+	assert.False(t, ssl)
+	assert.Equal(t, []string{"http://localhost:8091"}, seeds)
+
+	seeds, _, err = parseSeeds("10.0.0.1, 10.0.0.2:9000,::1", 8091, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"http://10.0.0.1:8091", "http://10.0.0.2:9000", "http://[::1]:8091"}, seeds)
+
+	seeds, ssl, err = parseSeeds("couchbase://h1,h2,h3", 8091, false)
+	assert.Nil(t, err)
+	assert.False(t, ssl)
+	assert.Equal(t, []string{"http://h1:8091", "http://h2:8091", "http://h3:8091"}, seeds)
+
+	seeds, ssl, err = parseSeeds("couchbases://h1,[fe80::1]:18092/travel-sample?network=external", 8091, false)
+	assert.Nil(t, err)
+	assert.True(t, ssl)
+	assert.Equal(t, []string{"https://h1:18091", "https://[fe80::1]:18092"}, seeds)
+
+	_, _, err = parseSeeds("http://h1", 8091, false)
+	assert.NotNil(t, err)
+	_, _, err = parseSeeds("couchbase://", 8091, false)
+	assert.NotNil(t, err)
+}
+
+func Test_SelectSeedFailsOver(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(503)
+	}))
+	defer down.Close()
+	unauthorized := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(401)
+	}))
+	defer unauthorized.Close()
+	defer func(seeds []string, url string) { seedURLs, baseURL = seeds, url }(seedURLs, baseURL)
+
+	seedURLs = []string{down.URL, unauthorized.URL}
+	baseURL = down.URL
+	assert.Nil(t, selectSeed(context.Background()))
+	assert.Equal(t, unauthorized.URL, baseURL)
+
+	seedURLs = []string{down.URL, down.URL}
+	baseURL = down.URL
+	err := selectSeed(context.Background())
+	assert.Len(t, err, 2)
+	assert.Equal(t, down.URL, baseURL)
+}
+
+func Test_ResolveClusterScope(t *testing.T) {
+	uuid := "9b5a2d4b6e7e4a0d8f1c"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"implementationVersion": "7.1.0-2556-enterprise", "uuid": "` + uuid + `"}`))
+	}))
+	defer server.Close()
+	defer func(url string, scope string) { baseURL, clusterScope = url, scope }(baseURL, clusterScope)
+	baseURL = server.URL
+
+	// the same cluster reached through reordered seeds keeps its state
+	clusterScope = "http://h1:8091,http://h2:8091"
+	assert.Nil(t, resolveClusterScope(context.Background()))
+	assert.Equal(t, "9b5a2d4b6e7e4a0d8f1c", clusterScope)
+	clusterScope = "http://h2:8091,http://h1:8091,http://h3:8091"
+	assert.Nil(t, resolveClusterScope(context.Background()))
+	assert.Equal(t, "9b5a2d4b6e7e4a0d8f1c", clusterScope)
+
+	uuid = ""
+	clusterScope = "http://h1:8091"
+	assert.Nil(t, resolveClusterScope(context.Background()))
+	assert.Equal(t, "http://h1:8091", clusterScope)
+}
+
+func Test_NodeURL(t *testing.T) {
+	defer func(ssl bool) { args.SSL = ssl }(args.SSL)
+	args.SSL = false
+	assert.Equal(t, "http://10.0.0.1:9000", nodeURL("10.0.0.1:9000"))
+	assert.Equal(t, "http://10.0.0.1:8091", nodeURL("10.0.0.1"))
+	args.SSL = true
+	assert.Equal(t, "https://10.0.0.1:18091", nodeURL("10.0.0.1:8091"))
+}
+
+func Test_SeedNode(t *testing.T) {
+	defer func(url string) { baseURL = url }(baseURL)
+	baseURL = "http://10.0.0.1:8091"
+	assert.Equal(t, "10.0.0.1:8091", seedNode())
+	baseURL = "https://cb1.example.com:18091"
+	assert.Equal(t, "cb1.example.com:8091", seedNode())
+	baseURL = "http://[fd00::1]:9000"
+	assert.Equal(t, "[fd00::1]:9000", seedNode())
+}
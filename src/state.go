@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// statePath : file in the state directory for name, scoped to the monitored cluster
+func statePath(name string) string {
+	scope := unsafeFileChars.ReplaceAllString(clusterScope, "_")
+	return filepath.Join(args.StatePath, scope+"-"+name+".json")
+}
+
+// loadState : reads the state saved under name, found is false when nothing was saved yet
+func loadState(name string, value interface{}) (bool, error) {
+	data, err := ioutil.ReadFile(statePath(name))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(data, value)
+}
+
+// saveState : atomically replaces the state saved under name
+func saveState(name string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(args.StatePath, 0700); err != nil {
+		return err
+	}
+	path := statePath(name)
+	tmp, err := ioutil.TempFile(args.StatePath, filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
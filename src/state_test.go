@@ -0,0 +1,36 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SaveAndLoadState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "couchbase-plugin-state")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer func(path string, scope string) { args.StatePath, clusterScope = path, scope }(args.StatePath, clusterScope)
+	args.StatePath = dir
+	clusterScope = "http://localhost:8091"
+
+	var missing map[string]int
+	found, err := loadState("test", &missing)
+	assert.Nil(t, err)
+	assert.False(t, found)
+
+	assert.Nil(t, saveState("test", map[string]int{"a": 1}))
+
+	var loaded map[string]int
+	found, err = loadState("test", &loaded)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, map[string]int{"a": 1}, loaded)
+
+	clusterScope = "http://otherhost:8091"
+	found, err = loadState("test", &loaded)
+	assert.Nil(t, err)
+	assert.False(t, found)
+}
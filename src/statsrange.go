@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/log"
+	"github.com/newrelic/infra-integrations-sdk/metric"
+	"github.com/newrelic/infra-integrations-sdk/sdk"
+)
+
+const (
+	legacyBackend = "legacy"
+	rangeBackend  = "range"
+	autoBackend   = "auto"
+
+	// rangeStatsMinVersion : first server version shipping the stats range API
+	rangeStatsMinVersion = 7
+)
+
+// zoomWindow : the samples span and interval, in seconds, of a stats zoom level
+type zoomWindow struct {
+	span int
+	step int
+}
+
+var zoomWindows = map[string]zoomWindow{
+	"minute": zoomWindow{60, 1},
+	"hour":   zoomWindow{3600, 4},
+}
+
+// rangeStat : the Couchbase 7 metric a configured metric is read from, set by the range entry of the metric catalogue
+type rangeStat struct {
+	name      string
+	labels    map[string]string
+	functions []string
+}
+
+type rangeLabel struct {
+	Label    string `json:"label"`
+	Value    string `json:"value"`
+	Operator string `json:"operator,omitempty"`
+}
+
+type rangeQuery struct {
+	Metric         []rangeLabel `json:"metric"`
+	ApplyFunctions []string     `json:"applyFunctions,omitempty"`
+	Nodes          []string     `json:"nodes,omitempty"`
+	Step           int          `json:"step"`
+	Start          int          `json:"start"`
+}
+
+type rangeResult struct {
+	Data []struct {
+		Metric map[string]interface{} `json:"metric"`
+		Values [][]interface{}        `json:"values"`
+	} `json:"data"`
+	Errors []interface{} `json:"errors"`
+}
+
+type bucketNode struct {
+	bucket string
+	node   string
+}
+
+// selectStatsBackend : resolves the auto backend from the server version reported by /pools
+func selectStatsBackend(ctx context.Context, backend string) (string, error) {
+	switch backend {
+	case legacyBackend, rangeBackend, prometheusBackend:
+		return backend, nil
+	case autoBackend:
+	default:
+		return "", fmt.Errorf("unknown stats backend '%s'", backend)
+	}
+
+	poolsData, err := httpGet(ctx, "/pools")
+	if err != nil {
+		return "", err
+	}
+	cluster, err := getClusterInfo(poolsData)
+	if err != nil {
+		return "", err
+	}
+	if majorVersion(cluster.ImplementationVersion) >= rangeStatsMinVersion {
+		return rangeBackend, nil
+	}
+	return legacyBackend, nil
+}
+
+func majorVersion(version string) int {
+	major, err := strconv.Atoi(strings.SplitN(version, ".", 2)[0])
+	if err != nil {
+		return 0
+	}
+	return major
+}
+
+func populateRangeStats(ctx context.Context, integration *sdk.Integration, cursors *sampleCursors, counters *counterStore, bucketArg string, nodeArg string) error {
+	names, queries := buildRangeQueries(bucketArg, nodeArg, zoomWindows[strings.TrimSpace(args.Zoom)])
+	body, err := json.Marshal(queries)
+	if err != nil {
+		return err
+	}
+	log.Debug("Processing metrics at /pools/default/stats/range")
+	statsData, err := httpPost(ctx, "/pools/default/stats/range", "application/json", body)
+	if err != nil {
+		return err
+	}
+	return setRangeStats(integration, cursors, counters, names, statsData, time.Now())
+}
+
+// buildRangeQueries : one query per configured metric, the returned names follow the order of the queries
+func buildRangeQueries(bucketArg string, nodeArg string, window zoomWindow) ([]string, []rangeQuery) {
+	names := []string{}
+	for metricName, def := range configuredMetrics {
+		if def.rangeStat == nil {
+			log.Warn("Metric %s has no range entry in the metric catalogue, it is not collected from the stats range API", metricName)
+			continue
+		}
+		names = append(names, metricName)
+	}
+	sort.Strings(names)
+
+	queries := []rangeQuery{}
+	for _, metricName := range names {
+		stat := configuredMetrics[metricName].rangeStat
+		query := rangeQuery{
+			Metric:         []rangeLabel{{Label: "name", Value: stat.name}},
+			ApplyFunctions: stat.functions,
+			Step:           window.step,
+			Start:          -window.span,
+		}
+		labels := make([]string, 0, len(stat.labels))
+		for label := range stat.labels {
+			labels = append(labels, label)
+		}
+		sort.Strings(labels)
+		for _, label := range labels {
+			query.Metric = append(query.Metric, rangeLabel{Label: label, Value: stat.labels[label]})
+		}
+		if bucketArg != "all" {
+			query.Metric = append(query.Metric, rangeLabel{Label: "bucket", Value: bucketArg})
+		}
+		if nodeArg != "all" {
+			query.Nodes = []string{nodeArg}
+		}
+		queries = append(queries, query)
+	}
+	return names, queries
+}
+
+// setRangeStats : aggregates the samples of each series newer than the cursor of its bucket and node and sums
+// the series of a bucket and node into one CouchbaseSample, the raw samples are summed by timestamp the same way.
+// A bucket and node without new samples reports nothing, the errors of the queries are returned once the samples are set.
+func setRangeStats(integration *sdk.Integration, cursors *sampleCursors, counters *counterStore, names []string, statsData []byte, sampledAt time.Time) error {
+	var results []rangeResult
+	if err := json.Unmarshal(statsData, &results); err != nil {
+		return err
+	}
+	if len(results) != len(names) {
+		return fmt.Errorf("stats range returned %d results for %d queries", len(results), len(names))
+	}
+
+	rawNames := map[string]bool{}
+	if cursors != nil {
+		for _, name := range rawSampleMetrics() {
+			rawNames[name] = true
+		}
+	}
+	samples := map[bucketNode]map[string]float64{}
+	raw := map[bucketNode]map[int64]map[string]float64{}
+	newest := map[bucketNode]int64{}
+	var failed collectionErrors
+	for i, result := range results {
+		failed = append(failed, rangeResultErrors(names[i], result)...)
+		for _, series := range result.Data {
+			bucket, _ := series.Metric["bucket"].(string)
+			if bucket == "" {
+				continue
+			}
+			key := bucketNode{bucket: bucket, node: seriesNode(series.Metric)}
+			timestamps, values := newRangeSamples(cursors, key, series.Values)
+			if len(timestamps) == 0 {
+				continue
+			}
+			if last := timestamps[len(timestamps)-1]; last > newest[key] {
+				newest[key] = last
+			}
+			if rawNames[names[i]] {
+				addRangeRawSamples(raw, key, configuredMetrics[names[i]].reportedName(names[i]), timestamps, values)
+			}
+			value, ok := aggregate(configuredMetrics[names[i]].aggregation, values)
+			if !ok {
+				continue
+			}
+			if _, ok := samples[key]; !ok {
+				samples[key] = map[string]float64{}
+			}
+			samples[key][names[i]] += value
+		}
+	}
+	if cursors != nil {
+		for key, ts := range newest {
+			cursors.advance(key.bucket, key.node, float64(ts))
+		}
+	}
+
+	keys := make([]bucketNode, 0, len(samples))
+	for key := range samples {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].bucket != keys[j].bucket {
+			return keys[i].bucket < keys[j].bucket
+		}
+		return keys[i].node < keys[j].node
+	})
+	for _, key := range keys {
+		ms := newMetricSet(integration, "CouchbaseSample")
+		ms.SetMetric("bucket", key.bucket, metric.ATTRIBUTE)
+		ms.SetMetric("node", key.node, metric.ATTRIBUTE)
+		values := map[string]float64{}
+		for metricName, value := range samples[key] {
+			setBucketMetric(ms, counters, key.bucket, key.node, metricName, configuredMetrics[metricName], value, sampledAt, values)
+		}
+		setDerivedMetrics(ms, values, configuredDerivedMetrics)
+	}
+	if len(raw) > 0 {
+		setRangeRawSamples(integration, raw)
+	}
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
+}
+
+// rangeResultErrors : the errors the stats range API reports for the query of a metric
+func rangeResultErrors(name string, result rangeResult) collectionErrors {
+	var failed collectionErrors
+	for _, e := range result.Errors {
+		failed = append(failed, collectionFailure("/pools/default/stats/range", "", "", fmt.Errorf("metric %s: %v", name, e)))
+	}
+	return failed
+}
+
+func seriesNode(labels map[string]interface{}) string {
+	if nodes, ok := labels["nodes"].([]interface{}); ok && len(nodes) > 0 {
+		return fmt.Sprint(nodes[0])
+	}
+	if node, ok := labels["instance"].(string); ok {
+		return node
+	}
+	return ""
+}
+
+// rangeValues : values are [timestamp, "value"] pairs, non numeric values such as NaN are skipped
+func rangeValues(pairs [][]interface{}) []float64 {
+	values := []float64{}
+	for _, pair := range pairs {
+		if len(pair) != 2 {
+			continue
+		}
+		if v, ok := rangeValue(pair[1]); ok {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// rangeSamples : the timestamps and numeric values of a series, the unix seconds of the stats range API
+// are turned into the unix milliseconds of the legacy stats
+func rangeSamples(pairs [][]interface{}) ([]int64, []float64) {
+	timestamps := []int64{}
+	values := []float64{}
+	for _, pair := range pairs {
+		if len(pair) != 2 {
+			continue
+		}
+		ts, ok := pair[0].(float64)
+		if !ok {
+			continue
+		}
+		if v, ok := rangeValue(pair[1]); ok {
+			timestamps = append(timestamps, int64(ts*1000))
+			values = append(values, v)
+		}
+	}
+	return timestamps, values
+}
+
+// newRangeSamples : the samples of a series newer than the cursor of its bucket and node, all of them on the first run
+func newRangeSamples(cursors *sampleCursors, key bucketNode, pairs [][]interface{}) ([]int64, []float64) {
+	timestamps, values := rangeSamples(pairs)
+	if cursors == nil {
+		return timestamps, values
+	}
+	since, found := cursors.since(key.bucket, key.node)
+	if !found {
+		return timestamps, values
+	}
+	newTimestamps := []int64{}
+	newValues := []float64{}
+	for i, ts := range timestamps {
+		if float64(ts) > since {
+			newTimestamps = append(newTimestamps, ts)
+			newValues = append(newValues, values[i])
+		}
+	}
+	return newTimestamps, newValues
+}
+
+func rangeValue(value interface{}) (float64, bool) {
+	s, ok := value.(string)
+	if !ok {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(v) {
+		return 0, false
+	}
+	return v, true
+}
+
+// withZoom : adds the zoom query parameter to a stats uri
+func withZoom(uri string, zoom string) string {
+	separator := "?"
+	if strings.Contains(uri, "?") {
+		separator = "&"
+	}
+	return uri + separator + "zoom=" + url.QueryEscape(zoom)
+}
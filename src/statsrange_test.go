@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/sdk"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MajorVersion(t *testing.T) {
+	assert.Equal(t, 7, majorVersion("7.0.2-6703-enterprise"))
+	assert.Equal(t, 5, majorVersion("5.0.1-5003-enterprise"))
+	assert.Equal(t, 0, majorVersion(""))
+}
+
+func Test_SelectStatsBackend(t *testing.T) {
+	version := "7.1.0-2556-enterprise"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"implementationVersion": "` + version + `", "uuid": "abc"}`))
+	}))
+	defer server.Close()
+	defer func(url string) { baseURL = url }(baseURL)
+	baseURL = server.URL
+
+	backend, err := selectStatsBackend(context.Background(), "auto")
+	assert.Nil(t, err)
+	assert.Equal(t, rangeBackend, backend)
+
+	version = "6.6.0-7909-enterprise"
+	backend, err = selectStatsBackend(context.Background(), "auto")
+	assert.Nil(t, err)
+	assert.Equal(t, legacyBackend, backend)
+
+	backend, err = selectStatsBackend(context.Background(), "range")
+	assert.Nil(t, err)
+	assert.Equal(t, rangeBackend, backend)
+
+	_, err = selectStatsBackend(context.Background(), "prometheus2")
+	assert.NotNil(t, err)
+}
+
+func Test_BuildRangeQueries(t *testing.T) {
+	names, queries := buildRangeQueries("travel-sample", "10.0.0.1:8091", zoomWindows["minute"])
+
+	assert.Equal(t, len(configuredMetrics), len(names))
+	assert.Equal(t, len(names), len(queries))
+	assert.Equal(t, "cmd_get", names[0])
+
+	body, err := json.Marshal(queries[0])
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{
+		"metric": [
+			{"label": "name", "value": "kv_ops"},
+			{"label": "op", "value": "get"},
+			{"label": "bucket", "value": "travel-sample"}
+		],
+		"applyFunctions": ["irate"],
+		"nodes": ["10.0.0.1:8091"],
+		"step": 1,
+		"start": -60
+	}`, string(body))
+}
+
+var rangeStatsJSON = `[
+	{
+		"data": [
+			{"metric": {"bucket": "travel-sample", "nodes": ["10.0.0.1:8091"], "result": "hit"}, "values": [[1, "10"], [2, "20"]]},
+			{"metric": {"bucket": "travel-sample", "nodes": ["10.0.0.1:8091"], "result": "miss"}, "values": [[1, "1"], [2, "NaN"]]},
+			{"metric": {"bucket": "travel-sample", "nodes": ["10.0.0.2:8091"]}, "values": [[1, "4"]]}
+		],
+		"errors": []
+	},
+	{
+		"data": [
+			{"metric": {"bucket": "travel-sample", "nodes": ["10.0.0.1:8091"]}, "values": [[1, "1048576"]]}
+		],
+		"errors": []
+	}
+]`
+
+func Test_SetRangeStats(t *testing.T) {
+	integration := &sdk.Integration{}
+
+	err := setRangeStats(integration, nil, &counterStore{entries: map[string]counterState{}}, []string{"cmd_get", "mem_used"}, []byte(rangeStatsJSON), time.Now())
+
+	assert.Nil(t, err)
+	assert.Len(t, integration.Metrics, 2)
+	first := integration.Metrics[0]
+	assert.Equal(t, "CouchbaseSample", first["event_type"])
+	assert.Equal(t, "travel-sample", first["bucket"])
+	assert.Equal(t, "10.0.0.1:8091", first["node"])
+	assert.Equal(t, float64(16), first["cmd_get"])
+	assert.Equal(t, float64(1048576), first["mem_used"])
+	assert.Equal(t, float64(4), integration.Metrics[1]["cmd_get"])
+	assert.NotContains(t, integration.Metrics[1], "mem_used")
+}
+
+func Test_SetRangeStatsAggregatesSinceLastRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "couchbase-plugin-state")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer func(path string) { args.StatePath = path }(args.StatePath)
+	args.StatePath = dir
+	counters := &counterStore{entries: map[string]counterState{}}
+
+	cursors, err := loadSampleCursors()
+	assert.Nil(t, err)
+	first := &sdk.Integration{}
+	assert.Nil(t, setRangeStats(first, cursors, counters, []string{"cmd_get", "mem_used"}, []byte(rangeStatsJSON), time.Now()))
+	assert.Len(t, first.Metrics, 2)
+	assert.Nil(t, cursors.save())
+
+	// the window of the next run overlaps the previous one
+	cursors, err = loadSampleCursors()
+	assert.Nil(t, err)
+	same := &sdk.Integration{}
+	assert.Nil(t, setRangeStats(same, cursors, counters, []string{"cmd_get", "mem_used"}, []byte(rangeStatsJSON), time.Now()))
+	assert.Empty(t, same.Metrics)
+	assert.Nil(t, cursors.save())
+
+	newer := `[
+		{"data": [{"metric": {"bucket": "travel-sample", "nodes": ["10.0.0.1:8091"]}, "values": [[1, "10"], [2, "20"], [3, "40"], [4, "60"]]}], "errors": []},
+		{"data": [{"metric": {"bucket": "travel-sample", "nodes": ["10.0.0.1:8091"]}, "values": [[2, "1048576"]]}], "errors": []}
+	]`
+	cursors, err = loadSampleCursors()
+	assert.Nil(t, err)
+	later := &sdk.Integration{}
+	assert.Nil(t, setRangeStats(later, cursors, counters, []string{"cmd_get", "mem_used"}, []byte(newer), time.Now()))
+	assert.Len(t, later.Metrics, 1)
+	assert.Equal(t, float64(50), later.Metrics[0]["cmd_get"])
+	assert.NotContains(t, later.Metrics[0], "mem_used")
+	assert.Equal(t, map[string]float64{"travel-sample/10.0.0.1:8091": 4000}, cursors.current)
+}
+
+func Test_SetRangeStatsReportsQueryErrors(t *testing.T) {
+	statsData := `[
+		{"data": [{"metric": {"bucket": "travel-sample", "nodes": ["10.0.0.1:8091"]}, "values": [[1, "10"]]}], "errors": []},
+		{"data": [], "errors": [{"node": "10.0.0.2:8091", "error": "timeout"}]}
+	]`
+	integration := &sdk.Integration{}
+
+	err := setRangeStats(integration, nil, &counterStore{entries: map[string]counterState{}}, []string{"cmd_get", "mem_used"}, []byte(statsData), time.Now())
+
+	failed, ok := err.(collectionErrors)
+	if assert.True(t, ok) && assert.Len(t, failed, 1) {
+		assert.Equal(t, "/pools/default/stats/range", failed[0].(*collectionError).endpoint)
+		assert.Contains(t, failed[0].Error(), "metric mem_used")
+		assert.Contains(t, failed[0].Error(), "timeout")
+	}
+	assert.Len(t, integration.Metrics, 1)
+	assert.Equal(t, float64(10), integration.Metrics[0]["cmd_get"])
+
+	setCollectionErrors(integration, []error{collectionFailure("/pools/default/stats/range", "", "", err)})
+	assert.Equal(t, "CouchbaseCollectionErrorSample", integration.Metrics[1]["event_type"])
+}
+
+func Test_WithZoom(t *testing.T) {
+	assert.Equal(t, "/pools/default/buckets/b/nodes/n/stats?zoom=minute", withZoom("/pools/default/buckets/b/nodes/n/stats", "minute"))
+	assert.Equal(t, "/stats?a=1&zoom=hour", withZoom("/stats?a=1", "hour"))
+}
+
+func Test_SetRangeStatsResultCountMismatch(t *testing.T) {
+	err := setRangeStats(&sdk.Integration{}, nil, &counterStore{entries: map[string]counterState{}}, []string{"cmd_get"}, []byte(rangeStatsJSON), time.Now())
+
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/newrelic/infra-integrations-sdk/metric"
+	"github.com/newrelic/infra-integrations-sdk/sdk"
+)
+
+const tasksState = "tasks"
+
+type runningTask struct {
+	Type     string  `json:"type"`
+	Bucket   string  `json:"bucket"`
+	Progress float64 `json:"progress"`
+}
+
+type progressTask struct {
+	Type           string
+	ID             string
+	Status         string
+	Bucket         string
+	DesignDocument string
+	Index          string
+	Progress       float64
+	ChangesDone    float64
+	TotalChanges   float64
+}
+
+func populateTaskStats(integration *sdk.Integration, tasksData []byte) error {
+	var previous map[string]runningTask
+	if _, err := loadState(tasksState, &previous); err != nil {
+		return err
+	}
+	current, err := setTaskStats(integration, tasksData, previous)
+	if err != nil {
+		return err
+	}
+	return saveState(tasksState, current)
+}
+
+// setTaskStats : reports running tasks and emits start and finish events against the tasks running on the previous run
+func setTaskStats(integration *sdk.Integration, tasksData []byte, previous map[string]runningTask) (map[string]runningTask, error) {
+	var tasks []progressTask
+	tasksAlias := "tasks"
+	config := Config{
+		Properties: []Property{
+			{Path: ".", Type: "[o]", Alias: &tasksAlias},
+		},
+	}
+	err := PickDeserializedUsingConfig(bytes.NewReader(tasksData), config, tasksAlias, &tasks)
+	if err != nil {
+		return nil, err
+	}
+
+	current := map[string]runningTask{}
+	for _, t := range tasks {
+		// replications never finish, they are reported as CouchbaseXdcrSample
+		if t.Type == "xdcr" || t.Status != "running" {
+			continue
+		}
+		key := taskKey(t)
+		running := runningTask{Type: t.Type, Bucket: t.Bucket, Progress: t.Progress}
+		current[key] = running
+
+		ms := newMetricSet(integration, "CouchbaseTaskSample")
+		ms.SetMetric("task", key, metric.ATTRIBUTE)
+		ms.SetMetric("type", t.Type, metric.ATTRIBUTE)
+		ms.SetMetric("status", t.Status, metric.ATTRIBUTE)
+		if t.Bucket != "" {
+			ms.SetMetric("bucket", t.Bucket, metric.ATTRIBUTE)
+		}
+		if t.DesignDocument != "" {
+			ms.SetMetric("designDocument", t.DesignDocument, metric.ATTRIBUTE)
+		}
+		if t.Index != "" {
+			ms.SetMetric("index", t.Index, metric.ATTRIBUTE)
+		}
+		ms.SetMetric("progress", t.Progress, metric.GAUGE)
+		if t.TotalChanges > 0 {
+			ms.SetMetric("changesDone", t.ChangesDone, metric.GAUGE)
+			ms.SetMetric("totalChanges", t.TotalChanges, metric.GAUGE)
+		}
+
+		if _, ok := previous[key]; !ok {
+			setTaskEvent(integration, key, "started", running)
+		}
+	}
+
+	finished := []string{}
+	for key := range previous {
+		if _, ok := current[key]; !ok {
+			finished = append(finished, key)
+		}
+	}
+	sort.Strings(finished)
+	for _, key := range finished {
+		setTaskEvent(integration, key, "finished", previous[key])
+	}
+	return current, nil
+}
+
+func taskKey(t progressTask) string {
+	if t.ID != "" {
+		return t.ID
+	}
+	parts := []string{t.Type}
+	for _, p := range []string{t.Bucket, t.DesignDocument, t.Index} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+func setTaskEvent(integration *sdk.Integration, key string, action string, t runningTask) {
+	ms := newMetricSet(integration, "CouchbaseTaskEvent")
+	ms.SetMetric("task", key, metric.ATTRIBUTE)
+	ms.SetMetric("type", t.Type, metric.ATTRIBUTE)
+	ms.SetMetric("action", action, metric.ATTRIBUTE)
+	if t.Bucket != "" {
+		ms.SetMetric("bucket", t.Bucket, metric.ATTRIBUTE)
+	}
+	ms.SetMetric("progress", t.Progress, metric.GAUGE)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/newrelic/infra-integrations-sdk/sdk"
+	"github.com/stretchr/testify/assert"
+)
+
+var runningTasksJSON = `[
+	{"type": "rebalance", "status": "running", "progress": 42.5, "perNode": {}},
+	{"type": "bucket_compaction", "status": "running", "bucket": "travel-sample", "progress": 10, "changesDone": 100, "totalChanges": 1000},
+	{"type": "xdcr", "id": "8f1c0a7e/beer-sample/beer-copy", "status": "running"}
+]`
+
+func Test_SetTaskStats(t *testing.T) {
+	integration := &sdk.Integration{}
+	previous := map[string]runningTask{
+		"rebalance": runningTask{Type: "rebalance", Progress: 20},
+		"view_compaction/beer-sample/_design/beer": runningTask{Type: "view_compaction", Bucket: "beer-sample", Progress: 90},
+	}
+
+	current, err := setTaskStats(integration, []byte(runningTasksJSON), previous)
+
+	assert.Nil(t, err)
+	assert.Len(t, current, 2)
+	assert.Equal(t, 42.5, current["rebalance"].Progress)
+	assert.Len(t, integration.Metrics, 4)
+
+	rebalance := integration.Metrics[0]
+	assert.Equal(t, "CouchbaseTaskSample", rebalance["event_type"])
+	assert.Equal(t, "rebalance", rebalance["type"])
+	assert.Equal(t, 42.5, rebalance["progress"])
+
+	compaction := integration.Metrics[1]
+	assert.Equal(t, "bucket_compaction/travel-sample", compaction["task"])
+	assert.Equal(t, "travel-sample", compaction["bucket"])
+	assert.Equal(t, float64(1000), compaction["totalChanges"])
+
+	started := integration.Metrics[2]
+	assert.Equal(t, "CouchbaseTaskEvent", started["event_type"])
+	assert.Equal(t, "started", started["action"])
+	assert.Equal(t, "bucket_compaction/travel-sample", started["task"])
+
+	finished := integration.Metrics[3]
+	assert.Equal(t, "finished", finished["action"])
+	assert.Equal(t, "view_compaction/beer-sample/_design/beer", finished["task"])
+	assert.Equal(t, float64(90), finished["progress"])
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/log"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func newHTTPClient(config *tls.Config) *http.Client {
+	transport := &http.Transport{TLSClientConfig: config}
+	return &http.Client{Transport: transport, Timeout: 10 * time.Second}
+}
+
+// configureHTTPClient : replaces the client used for every request with one using the TLS arguments
+func configureHTTPClient() error {
+	config, err := tlsConfig()
+	if err != nil {
+		return err
+	}
+	httpClient = newHTTPClient(config)
+	return nil
+}
+
+// tlsConfig : server certificates are verified against ca_bundle, or the system CAs, unless insecure_skip_verify is set
+func tlsConfig() (*tls.Config, error) {
+	version, ok := tlsVersions[strings.TrimSpace(args.MinTLSVersion)]
+	if !ok {
+		return nil, fmt.Errorf("unknown TLS version '%s'", args.MinTLSVersion)
+	}
+	config := &tls.Config{
+		MinVersion:         version,
+		ServerName:         strings.TrimSpace(args.ServerName),
+		InsecureSkipVerify: args.InsecureSkipVerify,
+	}
+	if args.InsecureSkipVerify {
+		log.Warn("Couchbase server certificates are not verified")
+	}
+
+	if caBundle := strings.TrimSpace(args.CABundle); caBundle != "" {
+		data, err := ioutil.ReadFile(caBundle)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no PEM certificate in CA bundle %s", caBundle)
+		}
+		config.RootCAs = pool
+	}
+
+	clientCert, clientKey := strings.TrimSpace(args.ClientCert), strings.TrimSpace(args.ClientKey)
+	if clientCert != "" || clientKey != "" {
+		if clientCert == "" || clientKey == "" {
+			return nil, fmt.Errorf("client_cert and client_key must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(clientCert, clientKey)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeCertificate : self signed certificate for name and 127.0.0.1, written as PEM files in dir
+func writeCertificate(t *testing.T, dir string, name string) (tls.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{name},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	certPath, keyPath := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	assert.Nil(t, ioutil.WriteFile(certPath, certPEM, 0600))
+	assert.Nil(t, ioutil.WriteFile(keyPath, keyPEM, 0600))
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	assert.Nil(t, err)
+	return cert, certPath, keyPath
+}
+
+func Test_TLSVerification(t *testing.T) {
+	dir, err := ioutil.TempDir("", "couchbase-plugin-tls")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	serverCert, caPath, _ := writeCertificate(t, dir, "couchbase.example")
+	_, clientCertPath, clientKeyPath := writeCertificate(t, dir, "monitor")
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{serverCert}, ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+	defer func(a argumentList, client *http.Client) { args, httpClient = a, client }(args, httpClient)
+	args.Retries, args.MinTLSVersion = 0, "1.2"
+	get := func() error {
+		if err := configureHTTPClient(); err != nil {
+			return err
+		}
+		_, err := httpGetURL(context.Background(), server.URL+"/pools")
+		return err
+	}
+
+	args.ClientCert, args.ClientKey = clientCertPath, clientKeyPath
+	assert.NotNil(t, get(), "unknown authority")
+
+	args.CABundle = caPath
+	assert.Nil(t, get())
+
+	args.ServerName = "other.example"
+	assert.NotNil(t, get(), "name mismatch")
+	args.ServerName = "couchbase.example"
+	assert.Nil(t, get())
+
+	args.ClientCert, args.ClientKey = "", ""
+	assert.NotNil(t, get(), "client certificate required")
+
+	args.ClientCert, args.ClientKey = clientCertPath, clientKeyPath
+	args.CABundle, args.ServerName, args.InsecureSkipVerify = "", "", true
+	assert.Nil(t, get())
+}
+
+func Test_TLSConfigErrors(t *testing.T) {
+	defer func(a argumentList) { args = a }(args)
+	args.MinTLSVersion = "2.0"
+	_, err := tlsConfig()
+	assert.EqualError(t, err, "unknown TLS version '2.0'")
+	args.MinTLSVersion = "1.3"
+
+	args.ClientCert = "client.crt"
+	_, err = tlsConfig()
+	assert.EqualError(t, err, "client_cert and client_key must be set together")
+	args.ClientCert = ""
+
+	dir, err := ioutil.TempDir("", "couchbase-plugin-tls")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	args.CABundle = filepath.Join(dir, "empty.pem")
+	assert.Nil(t, ioutil.WriteFile(args.CABundle, []byte("not a certificate"), 0600))
+	_, err = tlsConfig()
+	assert.NotNil(t, err)
+
+	args.CABundle = ""
+	config, err := tlsConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), config.MinVersion)
+	assert.False(t, config.InsecureSkipVerify)
+}
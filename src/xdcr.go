@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/newrelic/infra-integrations-sdk/log"
+	"github.com/newrelic/infra-integrations-sdk/metric"
+	"github.com/newrelic/infra-integrations-sdk/sdk"
+)
+
+var xdcrMetrics = map[string]metricDef{
+	"changes_left":           metricDef{metricT: gauge},
+	"docs_written":           metricDef{metricT: gauge},
+	"docs_processed":         metricDef{metricT: gauge},
+	"docs_failed_cr_source":  metricDef{metricT: gauge},
+	"docs_filtered":          metricDef{metricT: gauge},
+	"bandwidth_usage":        metricDef{metricT: gauge},
+	"rate_replicated":        metricDef{metricT: gauge},
+	"rate_received_from_dcp": metricDef{metricT: gauge},
+	"wtavg_docs_latency":     metricDef{metricT: gauge},
+	"wtavg_meta_latency":     metricDef{metricT: gauge},
+}
+
+type task struct {
+	Type   string
+	ID     string
+	Status string
+	Source string
+	Errors []interface{}
+}
+
+type remoteCluster struct {
+	Name    string
+	UUID    string
+	Deleted bool
+}
+
+type replication struct {
+	id            string
+	sourceBucket  string
+	targetCluster string
+	targetBucket  string
+	status        string
+	errors        []string
+}
+
+// xdcrRangeStat : the Couchbase 7 metric of a replication stat, scale converts it to the unit of the legacy stat
+type xdcrRangeStat struct {
+	stat  rangeStat
+	scale float64
+}
+
+var xdcrRangeStats = map[string]xdcrRangeStat{
+	"changes_left":           xdcrRangeStat{rangeStat{"xdcr_changes_left_total", nil, nil}, 1},
+	"docs_written":           xdcrRangeStat{rangeStat{"xdcr_docs_written_total", nil, nil}, 1},
+	"docs_processed":         xdcrRangeStat{rangeStat{"xdcr_docs_processed_total", nil, nil}, 1},
+	"docs_failed_cr_source":  xdcrRangeStat{rangeStat{"xdcr_docs_failed_cr_source_total", nil, nil}, 1},
+	"docs_filtered":          xdcrRangeStat{rangeStat{"xdcr_docs_filtered_total", nil, nil}, 1},
+	"bandwidth_usage":        xdcrRangeStat{rangeStat{"xdcr_bandwidth_usage_bytes_per_second", nil, nil}, 1},
+	"rate_replicated":        xdcrRangeStat{rangeStat{"xdcr_docs_written_total", nil, []string{"irate"}}, 1},
+	"rate_received_from_dcp": xdcrRangeStat{rangeStat{"xdcr_docs_received_from_dcp_total", nil, []string{"irate"}}, 1},
+	"wtavg_docs_latency":     xdcrRangeStat{rangeStat{"xdcr_wtavg_docs_latency_seconds", nil, nil}, 1000},
+	"wtavg_meta_latency":     xdcrRangeStat{rangeStat{"xdcr_wtavg_meta_latency_seconds", nil, nil}, 1000},
+}
+
+// populateXdcrStats : the replication stats are read from one bucket stats call per source bucket,
+// or from one stats range call with the range backend
+func populateXdcrStats(ctx context.Context, pool *workerPool, integration *sdk.Integration, backend string, tasksData []byte) error {
+	remoteClustersData, err := httpGet(ctx, "/pools/default/remoteClusters")
+	if err != nil {
+		return err
+	}
+	replications, err := getReplications(tasksData, remoteClustersData)
+	if err != nil {
+		return err
+	}
+
+	bucketArg := strings.TrimSpace(args.Bucket)
+	buckets := []string{}
+	byBucket := map[string][]replication{}
+	for _, r := range replications {
+		if bucketArg != "all" && bucketArg != r.sourceBucket {
+			continue
+		}
+		if _, ok := byBucket[r.sourceBucket]; !ok {
+			buckets = append(buckets, r.sourceBucket)
+		}
+		byBucket[r.sourceBucket] = append(byBucket[r.sourceBucket], r)
+	}
+	if len(buckets) == 0 {
+		return nil
+	}
+
+	if backend == rangeBackend {
+		pool.Go(seedNode(), func() error {
+			stats, err := getXdcrRangeStats(ctx, bucketArg, zoomWindows[strings.TrimSpace(args.Zoom)])
+			for _, bucket := range buckets {
+				for _, r := range byBucket[bucket] {
+					setXdcrStats(integration, r, stats[r.id])
+				}
+			}
+			return collectionFailure("/pools/default/stats/range", "", "", err)
+		})
+		return nil
+	}
+	for _, bucket := range buckets {
+		bucket := bucket
+		pool.Go(seedNode(), func() error {
+			statsURI := withZoom("/pools/default/buckets/"+bucket+"/stats", strings.TrimSpace(args.Zoom))
+			log.Debug("Reading replication stats of bucket %s", bucket)
+			statsData, err := httpGet(ctx, statsURI)
+			var samples map[string][]float64
+			if err == nil {
+				samples, err = bucketSamples(statsData)
+			}
+			for _, r := range byBucket[bucket] {
+				setXdcrStats(integration, r, replicationStats(samples, r))
+			}
+			return collectionFailure(statsURI, bucket, "", err)
+		})
+	}
+	return nil
+}
+
+func getTasks(tasksData []byte) ([]task, error) {
+	var tasks []task
+	tasksAlias := "tasks"
+	config := Config{
+		Properties: []Property{
+			{Path: ".", Type: "[o]", Alias: &tasksAlias},
+		},
+	}
+	err := PickDeserializedUsingConfig(bytes.NewReader(tasksData), config, tasksAlias, &tasks)
+	return tasks, err
+}
+
+func getReplications(tasksData []byte, remoteClustersData []byte) ([]replication, error) {
+	tasks, err := getTasks(tasksData)
+	if err != nil {
+		return nil, err
+	}
+	var clusters []remoteCluster
+	clustersAlias := "clusters"
+	config := Config{
+		Properties: []Property{
+			{Path: ".", Type: "[o]", Alias: &clustersAlias},
+		},
+	}
+	err = PickDeserializedUsingConfig(bytes.NewReader(remoteClustersData), config, clustersAlias, &clusters)
+	if err != nil {
+		return nil, err
+	}
+	clusterNames := map[string]string{}
+	deleted := map[string]bool{}
+	for _, c := range clusters {
+		clusterNames[c.UUID] = c.Name
+		deleted[c.UUID] = c.Deleted
+	}
+
+	var replications []replication
+	for _, t := range tasks {
+		if t.Type != "xdcr" {
+			continue
+		}
+		// replication ids are <remote cluster uuid>/<source bucket>/<target bucket>
+		parts := strings.Split(t.ID, "/")
+		if len(parts) != 3 {
+			log.Debug("Skipping replication with unexpected id %s", t.ID)
+			continue
+		}
+		if deleted[parts[0]] {
+			log.Debug("Skipping replication %s to a deleted remote cluster", t.ID)
+			continue
+		}
+		targetCluster, ok := clusterNames[parts[0]]
+		if !ok {
+			targetCluster = parts[0]
+		}
+		r := replication{
+			id:            t.ID,
+			sourceBucket:  parts[1],
+			targetCluster: targetCluster,
+			targetBucket:  parts[2],
+			status:        t.Status,
+		}
+		for _, e := range t.Errors {
+			r.errors = append(r.errors, fmt.Sprint(e))
+		}
+		replications = append(replications, r)
+	}
+	return replications, nil
+}
+
+// bucketSamples : the op/samples of bucket stats by stat name, the entries that are not lists of numbers are left out
+func bucketSamples(statsData []byte) (map[string][]float64, error) {
+	var stats struct {
+		Op struct {
+			Samples map[string]json.RawMessage
+		}
+	}
+	if err := json.Unmarshal(statsData, &stats); err != nil {
+		return nil, err
+	}
+	samples := map[string][]float64{}
+	for name, raw := range stats.Op.Samples {
+		var values []float64
+		if err := json.Unmarshal(raw, &values); err == nil {
+			samples[name] = values
+		}
+	}
+	return samples, nil
+}
+
+// replicationStats : averages the cluster wide samples of the replication stats, the stats
+// not known to the server version are left out
+func replicationStats(samples map[string][]float64, r replication) map[string]float64 {
+	stats := map[string]float64{}
+	for statName := range xdcrMetrics {
+		if value, ok := aggregate(defaultAggregation, samples["replications/"+r.id+"/"+statName]); ok {
+			stats[statName] = value
+		}
+	}
+	return stats
+}
+
+// getXdcrRangeStats : the replication stats by replication id, the series of every node and pipeline of a replication are summed
+func getXdcrRangeStats(ctx context.Context, bucketArg string, window zoomWindow) (map[string]map[string]float64, error) {
+	names := make([]string, 0, len(xdcrRangeStats))
+	for name := range xdcrRangeStats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	queries := []rangeQuery{}
+	for _, name := range names {
+		stat := xdcrRangeStats[name].stat
+		query := rangeQuery{
+			Metric:         []rangeLabel{{Label: "name", Value: stat.name}},
+			ApplyFunctions: stat.functions,
+			Step:           window.step,
+			Start:          -window.span,
+		}
+		if bucketArg != "all" {
+			query.Metric = append(query.Metric, rangeLabel{Label: "sourceBucketName", Value: bucketArg})
+		}
+		queries = append(queries, query)
+	}
+	body, err := json.Marshal(queries)
+	if err != nil {
+		return nil, err
+	}
+	statsData, err := httpPost(ctx, "/pools/default/stats/range", "application/json", body)
+	if err != nil {
+		return nil, err
+	}
+	return setXdcrRangeStats(names, statsData)
+}
+
+// setXdcrRangeStats : the errors of the queries are returned with the stats of the others
+func setXdcrRangeStats(names []string, statsData []byte) (map[string]map[string]float64, error) {
+	var results []rangeResult
+	if err := json.Unmarshal(statsData, &results); err != nil {
+		return nil, err
+	}
+	if len(results) != len(names) {
+		return nil, fmt.Errorf("stats range returned %d results for %d queries", len(results), len(names))
+	}
+	stats := map[string]map[string]float64{}
+	var failed collectionErrors
+	for i, result := range results {
+		failed = append(failed, rangeResultErrors("xdcr "+names[i], result)...)
+		for _, series := range result.Data {
+			uuid, _ := series.Metric["targetClusterUUID"].(string)
+			source, _ := series.Metric["sourceBucketName"].(string)
+			target, _ := series.Metric["targetBucketName"].(string)
+			value, ok := aggregate(defaultAggregation, rangeValues(series.Values))
+			if uuid == "" || source == "" || target == "" || !ok {
+				continue
+			}
+			id := uuid + "/" + source + "/" + target
+			if _, ok := stats[id]; !ok {
+				stats[id] = map[string]float64{}
+			}
+			stats[id][names[i]] += value * xdcrRangeStats[names[i]].scale
+		}
+	}
+	if len(failed) > 0 {
+		return stats, failed
+	}
+	return stats, nil
+}
+
+func setXdcrStats(integration *sdk.Integration, r replication, stats map[string]float64) {
+	ms := newMetricSet(integration, "CouchbaseXdcrSample")
+	ms.SetMetric("sourceBucket", r.sourceBucket, metric.ATTRIBUTE)
+	ms.SetMetric("targetCluster", r.targetCluster, metric.ATTRIBUTE)
+	ms.SetMetric("targetBucket", r.targetBucket, metric.ATTRIBUTE)
+	ms.SetMetric("status", r.status, metric.ATTRIBUTE)
+	ms.SetMetric("errors", len(r.errors), metric.GAUGE)
+	if len(r.errors) > 0 {
+		ms.SetMetric("lastError", r.errors[len(r.errors)-1], metric.ATTRIBUTE)
+	}
+	for statName, v := range stats {
+		ms.SetMetric(statName, v, sourceType(xdcrMetrics[statName].metricT))
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/newrelic/infra-integrations-sdk/sdk"
+	"github.com/stretchr/testify/assert"
+)
+
+var xdcrTasksJSON = `[
+	{"type": "rebalance", "status": "notRunning", "statusIsStale": false},
+	{
+		"type": "xdcr",
+		"id": "8f1c0a7e/beer-sample/beer-copy",
+		"source": "beer-sample",
+		"target": "/remoteClusters/8f1c0a7e/buckets/beer-copy",
+		"status": "running",
+		"errors": ["2017-11-05 10:00:00 connection refused", "2017-11-05 10:01:00 timeout"]
+	},
+	{
+		"type": "xdcr",
+		"id": "dead0001/beer-sample/beer-old",
+		"source": "beer-sample",
+		"status": "running",
+		"errors": []
+	},
+	{
+		"type": "xdcr",
+		"id": "0000ffff/travel-sample/travel-sample",
+		"source": "travel-sample",
+		"status": "paused",
+		"errors": []
+	}
+]`
+
+var remoteClustersJSON = `[
+	{"name": "dc2", "uuid": "8f1c0a7e", "hostname": "10.1.0.1:8091", "deleted": false},
+	{"name": "dc3", "uuid": "dead0001", "hostname": "10.2.0.1:8091", "deleted": true}
+]`
+
+var replicationBucketStatsJSON = `{
+	"op": {
+		"samples": {
+			"timestamp": [1000, 2000, 3000],
+			"replications/8f1c0a7e/beer-sample/beer-copy/changes_left": [10, 20, 30],
+			"replications/8f1c0a7e/beer-sample/beer-copy/wtavg_docs_latency": [4, 4, 4],
+			"cmd_get": [1, 2, 3]
+		},
+		"lastTStamp": 3000
+	}
+}`
+
+func Test_GetReplications(t *testing.T) {
+	replications, err := getReplications([]byte(xdcrTasksJSON), []byte(remoteClustersJSON))
+
+	assert.Nil(t, err)
+	// the replication to the deleted dc3 is skipped
+	assert.Len(t, replications, 2)
+	assert.Equal(t, "beer-sample", replications[0].sourceBucket)
+	assert.Equal(t, "dc2", replications[0].targetCluster)
+	assert.Equal(t, "beer-copy", replications[0].targetBucket)
+	assert.Equal(t, "running", replications[0].status)
+	assert.Len(t, replications[0].errors, 2)
+	assert.Equal(t, "0000ffff", replications[1].targetCluster)
+}
+
+func Test_ReplicationStats(t *testing.T) {
+	samples, err := bucketSamples([]byte(replicationBucketStatsJSON))
+	assert.Nil(t, err)
+	r := replication{id: "8f1c0a7e/beer-sample/beer-copy", sourceBucket: "beer-sample"}
+
+	stats := replicationStats(samples, r)
+
+	assert.Equal(t, map[string]float64{"changes_left": 20, "wtavg_docs_latency": 4}, stats)
+	assert.Empty(t, replicationStats(nil, r))
+}
+
+var xdcrRangeStatsJSON = `[
+	{
+		"data": [
+			{"metric": {"targetClusterUUID": "8f1c0a7e", "sourceBucketName": "beer-sample", "targetBucketName": "beer-copy", "pipelineType": "Main", "nodes": ["10.0.0.1:8091"]}, "values": [[1, "10"], [2, "30"]]},
+			{"metric": {"targetClusterUUID": "8f1c0a7e", "sourceBucketName": "beer-sample", "targetBucketName": "beer-copy", "pipelineType": "Main", "nodes": ["10.0.0.2:8091"]}, "values": [[1, "5"]]}
+		],
+		"errors": []
+	},
+	{
+		"data": [
+			{"metric": {"targetClusterUUID": "8f1c0a7e", "sourceBucketName": "beer-sample", "targetBucketName": "beer-copy"}, "values": [[1, "0.004"], [2, "NaN"]]}
+		],
+		"errors": []
+	}
+]`
+
+func Test_SetXdcrRangeStats(t *testing.T) {
+	stats, err := setXdcrRangeStats([]string{"changes_left", "wtavg_docs_latency"}, []byte(xdcrRangeStatsJSON))
+
+	assert.Nil(t, err)
+	assert.Equal(t, float64(25), stats["8f1c0a7e/beer-sample/beer-copy"]["changes_left"])
+	assert.Equal(t, float64(4), stats["8f1c0a7e/beer-sample/beer-copy"]["wtavg_docs_latency"])
+
+	_, err = setXdcrRangeStats([]string{"changes_left"}, []byte(xdcrRangeStatsJSON))
+	assert.NotNil(t, err)
+}
+
+func Test_PopulateXdcrStatsOneCallPerBucket(t *testing.T) {
+	requests := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		switch r.URL.Path {
+		case "/pools/default/remoteClusters":
+			w.Write([]byte(remoteClustersJSON))
+		case "/pools/default/buckets/beer-sample/stats":
+			w.Write([]byte(replicationBucketStatsJSON))
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer server.Close()
+	defer func(a argumentList, url string) { args, baseURL = a, url }(args, baseURL)
+	baseURL = server.URL
+	args.Bucket, args.Zoom, args.Retries = "beer-sample", "minute", 0
+
+	integration := &sdk.Integration{}
+	pool := newWorkerPool(context.Background(), 1, 1)
+	assert.Nil(t, populateXdcrStats(context.Background(), pool, integration, legacyBackend, []byte(xdcrTasksJSON)))
+	assert.Empty(t, pool.Wait())
+
+	assert.Equal(t, []string{"/pools/default/remoteClusters", "/pools/default/buckets/beer-sample/stats"}, requests)
+	assert.Len(t, integration.Metrics, 1)
+	assert.Equal(t, "beer-copy", integration.Metrics[0]["targetBucket"])
+	assert.Equal(t, float64(20), integration.Metrics[0]["changes_left"])
+}
+
+func Test_SetXdcrStats(t *testing.T) {
+	integration := &sdk.Integration{}
+	replications, _ := getReplications([]byte(xdcrTasksJSON), []byte(remoteClustersJSON))
+
+	setXdcrStats(integration, replications[0], map[string]float64{"changes_left": 25})
+
+	ms := integration.Metrics[0]
+	assert.Equal(t, "CouchbaseXdcrSample", ms["event_type"])
+	assert.Equal(t, "dc2", ms["targetCluster"])
+	assert.Equal(t, 2, ms["errors"])
+	assert.Equal(t, "2017-11-05 10:01:00 timeout", ms["lastError"])
+	assert.Equal(t, float64(25), ms["changes_left"])
+}